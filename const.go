@@ -1,8 +1,18 @@
 package jasync
 
 const (
-	STATUS_INIT  = 0
-	STATUS_QUEUE = 1
-	STATUS_DOING = 2
-	STATUS_DONE  = 3
+	STATUS_INIT    = 0
+	STATUS_QUEUE   = 1
+	STATUS_DOING   = 2
+	STATUS_DONE    = 3
+	STATUS_CANCEL  = 4 // ctx被取消，任务未被派发
+	STATUS_TIMEOUT = 5 // 任务执行超时
+	STATUS_FAIL    = 6 // 任务执行失败，如发生panic或返回了非nil的error
+	STATUS_SKIP    = 7 // 前置任务未成功执行，任务被跳过
+)
+
+// 任务的派发顺序
+const (
+	ORDER_FIFO = 0 // 按添加顺序派发
+	ORDER_LIFO = 1 // 后添加的任务先派发
 )
@@ -0,0 +1,161 @@
+package jasync
+
+import (
+	"fmt"
+	"time"
+)
+
+// AdaptiveLimit 自适应并发数(AIMD)的配置
+//
+// 每统计一个窗口的任务调整一次并发数：任务耗时或失败率超过阈值时乘以Backoff，否则加1，并限制在[Min, Max]之间
+type AdaptiveLimit struct {
+	Min            int64         // 最小并发数，<1时按1处理
+	Max            int64         // 最大并发数，为0时关闭自适应
+	Latency        time.Duration // 窗口内任务的平均耗时超过该值时减小并发数，<=0表示不按耗时判断
+	MaxFailureRate float64       // 窗口内任务的失败率超过该值时减小并发数，为0表示有任务失败即减小
+	Window         int           // 窗口的任务数，<=0时为当前并发数
+	Backoff        float64       // 减小并发数时乘以的系数，不在(0, 1)之间时按0.5处理
+}
+
+// 自适应并发数的控制器，由AsyncRealtime.mu保护
+type adaptiveLimiter struct {
+	cfg     AdaptiveLimit
+	limit   int64
+	count   int           // 窗口内已结束的任务数
+	failed  int           // 窗口内失败、超时的任务数
+	latency time.Duration // 窗口内任务耗时之和
+}
+
+// 限制n在[Min, Max]之间
+func (l *adaptiveLimiter) clamp(n int64) int64 {
+	if n < l.cfg.Min {
+		return l.cfg.Min
+	}
+	if n > l.cfg.Max {
+		return l.cfg.Max
+	}
+	return n
+}
+
+// 记录一个结束的任务，窗口结束时返回新的并发数
+//
+// 被取消的任务不计入窗口
+func (l *adaptiveLimiter) observe(status int, d time.Duration) (int64, bool) {
+	if l == nil || status == STATUS_CANCEL || status == STATUS_SKIP {
+		return 0, false
+	}
+	l.count++
+	l.latency += d
+	if status == STATUS_FAIL || status == STATUS_TIMEOUT {
+		l.failed++
+	}
+	window := l.cfg.Window
+	if window <= 0 {
+		window = int(l.limit)
+	}
+	if l.count < window {
+		return 0, false
+	}
+	overload := float64(l.failed)/float64(l.count) > l.cfg.MaxFailureRate ||
+		l.cfg.Latency > 0 && l.latency/time.Duration(l.count) > l.cfg.Latency
+	l.count, l.failed, l.latency = 0, 0, 0
+	limit := l.limit + 1
+	if overload {
+		limit = int64(float64(l.limit) * l.cfg.Backoff)
+	}
+	limit = l.clamp(limit)
+	if limit == l.limit {
+		return 0, false
+	}
+	l.limit = limit
+	return limit, true
+}
+
+// 进度信息中输出的自适应并发数的范围
+func (l *adaptiveLimiter) progress() string {
+	if l == nil {
+		return ""
+	}
+	return fmt.Sprintf(" adaptive:[%d,%d]", l.cfg.Min, l.cfg.Max)
+}
+
+// SetAdaptiveLimit 开启自适应并发数，根据任务的耗时与失败率在[Min, Max]之间调整并发数
+//
+// 初始并发数为当前并发数，可在运行期间调用；l.Max为0时关闭自适应，保持当前并发数
+func (ar *AsyncRealtime) SetAdaptiveLimit(l AdaptiveLimit) error {
+	if l.Max == 0 {
+		ar.mu.Lock()
+		ar.adaptive = nil
+		ar.mu.Unlock()
+		return nil
+	}
+	if l.Min < 1 {
+		l.Min = 1
+	}
+	if l.Max < l.Min {
+		return fmt.Errorf("最大并发数%d小于最小并发数%d", l.Max, l.Min)
+	}
+	if l.Backoff <= 0 || l.Backoff >= 1 {
+		l.Backoff = 0.5
+	}
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	ar.adaptive = &adaptiveLimiter{cfg: l}
+	ar.adaptive.limit = ar.adaptive.clamp(ar.maxConcurrency)
+	ar.fitWaiting()
+	ar.setConcurrency(ar.adaptive.limit)
+	return nil
+}
+
+// 记录结束的任务，需要时调整并发数
+func (ar *AsyncRealtime) adapt(status int, d time.Duration) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if _, ok := ar.adaptive.observe(status, d); ok {
+		ar.fitWaiting()
+		ar.setConcurrency(ar.adaptive.limit)
+	}
+}
+
+// 记录等待信号量的任务的权重，返回的函数用于在等待结束后取消记录
+//
+// 自适应并发数只在任务结束时调整，权重超过当前并发数的任务可能一直阻塞，因此等待期间并发数不小于其权重
+func (ar *AsyncRealtime) waitWeight(n int64) func() {
+	if n <= 1 {
+		return func() {}
+	}
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if ar.waiting == nil {
+		ar.waiting = make(map[int64]int)
+	}
+	ar.waiting[n]++
+	if ar.fitWaiting() {
+		ar.setConcurrency(ar.adaptive.limit)
+	}
+	return func() {
+		ar.mu.Lock()
+		defer ar.mu.Unlock()
+		if ar.waiting[n]--; ar.waiting[n] == 0 {
+			delete(ar.waiting, n)
+		}
+	}
+}
+
+// 开启了自适应并发数时，将其并发数增大到等待信号量的任务的最大权重，返回是否增大，需持有锁
+func (ar *AsyncRealtime) fitWaiting() bool {
+	if ar.adaptive == nil {
+		return false
+	}
+	var n int64
+	for w := range ar.waiting {
+		if w > n {
+			n = w
+		}
+	}
+	if n = ar.adaptive.clamp(n); n <= ar.adaptive.limit {
+		return false
+	}
+	ar.adaptive.limit = n
+	return true
+}
@@ -0,0 +1,46 @@
+package jasync
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAsyncRealtime_AdaptiveLimit(t *testing.T) {
+	ar := NewAR(4, false)
+	if ar.SetAdaptiveLimit(AdaptiveLimit{Min: 3, Max: 2}) == nil {
+		t.Fatal("Max < Min should fail")
+	}
+	ar.SetAdaptiveLimit(AdaptiveLimit{Min: 1, Max: 5, Latency: 20 * time.Millisecond, Window: 2})
+	limit := func() int64 {
+		ar.mu.RLock()
+		defer ar.mu.RUnlock()
+		return ar.maxConcurrency
+	}
+	run := func(n int, fn interface{}) {
+		for i := 0; i < n; i++ {
+			ar.AddAndRun("", fn, nil)
+		}
+		ar.Wait()
+	}
+	// 失败时乘性减小
+	run(2, func() error { return errors.New("failed") })
+	if l := limit(); l != 2 {
+		t.Fatalf("limit after failures: %d", l)
+	}
+	// 耗时超过阈值时减小，不低于Min
+	run(4, func() { time.Sleep(30 * time.Millisecond) })
+	if l := limit(); l != 1 {
+		t.Fatalf("limit after slow tasks: %d", l)
+	}
+	// 正常时加性增大，不超过Max
+	run(20, func() {})
+	if l := limit(); l != 5 || ar.sem.GetSize() != 5 {
+		t.Fatalf("limit after fast tasks: %d", l)
+	}
+	// 手动设置的并发数被限制在范围内
+	ar.SetConcurrency(9)
+	if l := limit(); l != 5 {
+		t.Fatalf("limit after SetConcurrency: %d", l)
+	}
+}
@@ -0,0 +1,138 @@
+package jasync
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"time"
+)
+
+// PanicError 任务函数发生panic时记录的错误
+type PanicError struct {
+	Value interface{} // recover()得到的值
+	Stack []byte      // 发生panic时的调用栈
+}
+
+func newPanicError(v interface{}) *PanicError {
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// 根据任务执行返回的错误获取任务状态
+func statusOfErr(err error) int {
+	switch err {
+	case nil:
+		return STATUS_DONE
+	case context.DeadlineExceeded:
+		return STATUS_TIMEOUT
+	case context.Canceled:
+		return STATUS_CANCEL
+	}
+	return STATUS_FAIL
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// 获取任务函数的返回值，最后一个返回值类型为error且非nil时返回该error
+func lastError(values []reflect.Value) error {
+	if len(values) == 0 {
+		return nil
+	}
+	v := values[len(values)-1]
+	if v.Type() != errorType || v.IsNil() {
+		return nil
+	}
+	return v.Interface().(error)
+}
+
+// 将任务函数的返回值转换为[]interface{}
+func valuesToInterfaces(values []reflect.Value) []interface{} {
+	resultItems := make([]interface{}, len(values))
+	for k, v := range values {
+		resultItems[k] = v.Interface()
+	}
+	return resultItems
+}
+
+// 如果传入了printHandler,并且reqHandler函数返回参数的个数与printHandler函数形参个数相同，则调用printHandler
+func callPrintHandler(reqHandler reflect.Value, printHandler reflect.Value, results []interface{}) {
+	if len(results) == 0 || !printHandler.IsValid() || reqHandler.Type().NumOut() != printHandler.Type().NumIn() {
+		return
+	}
+	paramsArg := make([]reflect.Value, len(results))
+	for k, v := range results {
+		if reflect.ValueOf(v).IsValid() {
+			paramsArg[k] = reflect.ValueOf(v)
+		} else {
+			paramsArg[k] = reflect.Zero(printHandler.Type().In(k))
+		}
+	}
+	printHandler.Call(paramsArg)
+}
+
+// 判断是否需要向任务函数注入ctx
+//
+// 任务函数的第一个形参为context.Context，且传入的实参个数比形参少一个时注入；可变参数函数总是注入
+func needContext(handlerType reflect.Type, argNum int) bool {
+	if handlerType.NumIn() == 0 || handlerType.In(0) != contextType {
+		return false
+	}
+	return handlerType.IsVariadic() || handlerType.NumIn() == argNum+1
+}
+
+// 调用fn，fn发生panic时返回*PanicError
+func safeCall(fn func() ([]reflect.Value, error)) (values []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newPanicError(r)
+		}
+	}()
+	return fn()
+}
+
+type callResult struct {
+	values []reflect.Value
+	err    error
+}
+
+// 调用fn，设置了超时时间时，超时后直接返回context.DeadlineExceeded，fn在后台继续执行直至返回
+func callWithTimeout(timeout time.Duration, fn func() ([]reflect.Value, error)) ([]reflect.Value, error) {
+	if timeout <= 0 {
+		return safeCall(fn)
+	}
+	ch := make(chan callResult, 1)
+	go func() {
+		values, err := safeCall(fn)
+		ch <- callResult{values: values, err: err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.values, r.err
+	case <-timer.C:
+		return nil, context.DeadlineExceeded
+	}
+}
+
+// 通过invoke调用任务函数，需要时在实参前注入ctx
+func callHandler(ctx context.Context, opt *taskOption, invoke Invoker, taskName string, handler reflect.Value, withCtx bool, params []reflect.Value) ([]reflect.Value, error) {
+	if opt.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.timeout)
+		defer cancel()
+	}
+	if withCtx {
+		params = append([]reflect.Value{reflect.ValueOf(ctx)}, params...)
+	}
+	return callWithTimeout(opt.timeout, func() ([]reflect.Value, error) {
+		return invoke(ctx, &Invocation{TaskName: taskName, Handler: handler, Args: params})
+	})
+}
@@ -10,6 +10,7 @@ type globalConfig struct {
 	MaxGoroutinCount      int
 	realtimeGoroutinCount int
 	mu                    *sync.RWMutex
+	cond                  *sync.Cond // realtimeGoroutinCount减少时广播，在Wait中创建
 }
 
 func (p *globalConfig) AddGlobalGoroutinCount() {
@@ -20,18 +21,23 @@ func (p *globalConfig) AddGlobalGoroutinCount() {
 func (p *globalConfig) SubGlobalGoroutinCount() {
 	p.mu.Lock()
 	p.realtimeGoroutinCount--
+	if p.cond != nil {
+		p.cond.Broadcast()
+	}
 	p.mu.Unlock()
 }
 
+// Wait 等待直到协程数量小于MaxGoroutinCount
 func (p *globalConfig) Wait() {
-	p.mu.RLock()
-	for {
-		if p.realtimeGoroutinCount < p.MaxGoroutinCount {
-			break
-		}
+	p.mu.Lock()
+	if p.cond == nil {
+		p.cond = sync.NewCond(p.mu)
+	}
+	for p.realtimeGoroutinCount >= p.MaxGoroutinCount {
 		log.Println("达到最大协程数量限制")
+		p.cond.Wait()
 	}
-	p.mu.RUnlock()
+	p.mu.Unlock()
 }
 
 // async配置
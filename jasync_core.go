@@ -8,6 +8,7 @@ package jasync
 // 通过调用 PrintAllTaskStatus() 来获取任务执行的状态
 // 通过调用 GetTaskAllTotal() 来获取所有任务的数量
 import (
+	"context"
 	"fmt"
 	"github.com/chroblert/jlog"
 	"github.com/hashicorp/go-uuid"
@@ -19,6 +20,7 @@ import (
 
 // 异步执行所需要的数据
 type asyncTask struct {
+	name         string
 	ReqHandler   reflect.Value
 	PrintHandler reflect.Value
 	Params       []reflect.Value
@@ -26,6 +28,18 @@ type asyncTask struct {
 	// 因而需要采用结构体指针的形式 refer: https://haobook.readthedocs.io/zh_CN/latest/periodical/201611/zhangan.html
 	TaskStatus  *taskStatusStruct
 	StoreResult bool // 220509: 决定是否存储结果
+	opt         *taskOption
+	withCtx     bool // 是否需要向ReqHandler注入ctx
+	future      *Future
+	cancel      context.CancelFunc // 任务执行期间用于取消任务的ctx
+	stream      *resultStream      // 通过RunStream派发时，用于发送任务的结果
+	queueTime   int64              // 进入派发队列的时间戳，纳秒
+	queueSeq    int                // 在派发队列中的序号
+	named       *namedTask         // 通过注册表添加的任务，会被写入日志
+	injected    []reflect.Value    // 注入的前置任务的返回值，位于Params之前
+	keep        bool               // 是否保留返回值，供依赖它的任务注入
+	outValues   []reflect.Value    // keep为true时保留的返回值
+	span        Span               // 任务执行期间的span，未设置Tracer时为nil
 }
 
 // Async 异步执行对象
@@ -34,6 +48,9 @@ type Async struct {
 	taskNeedDoCount int // 需要执行的任务数量
 	taskDoingCount  int // 正在执行的任务数量
 	tasks           map[string]*asyncTask
+	order           []*asyncTask  // 按添加顺序保存的任务
+	dispatchOrder   int           // 任务的派发顺序，ORDER_FIFO或ORDER_LIFO
+	priorityAging   time.Duration // 任务在队列中每等待该时长，优先级提升1，<=0表示不提升
 	mu              *sync.RWMutex
 
 	//210519：获取异步执行结果
@@ -48,29 +65,62 @@ type Async struct {
 	sem *semaphore.Weighted
 	//
 	wg *sync.WaitGroup
+	// 正在执行或需要执行的任务数量变化时广播，用于wait、Wait
+	cond *sync.Cond
+	// 任务开始执行前的限速
+	limiter *RateLimiter
+	// 按key的并发数与速率限制
+	keys *keyLimiter
+	// AddNamed、ResumeFrom使用的任务函数注册表
+	registry *Registry
+	// 任务日志
+	journal *journal
+	// 调度器指标
+	metrics *Metrics
+	// 任务状态变化时调用的钩子函数
+	hooks      *hooks
+	hookEvents []hookEvent
+	hookMu     *sync.Mutex
+	// 包装任务函数调用的中间件
+	middlewares []Middleware
+	// 追踪任务执行的Tracer
+	tracer Tracer
+	// 任务通过WithResources声明的资源需求所使用的信号量
+	resources *MultiWeighted
+	// 是否暂停派发任务
+	paused bool
 }
 
 // New 创建一个新的异步执行对象
 //
 // verbose: 是否显示进度条,默认显示
 func New(verbose ...bool) Async {
+	mu := new(sync.RWMutex)
 	if len(verbose) == 0 {
 		return Async{
 			tasks:       make(map[string]*asyncTask),
-			mu:          new(sync.RWMutex),
+			mu:          mu,
 			tasksResult: make(map[string][]interface{}),
 			verbose:     true,
 			sem:         semaphore.NewWeighted(100),
 			wg:          &sync.WaitGroup{},
+			cond:        sync.NewCond(mu),
+			limiter:     NewRateLimiter(0, 0),
+			keys:        newKeyLimiter(),
+			hookMu:      new(sync.Mutex),
 		}
 	}
 	return Async{
 		tasks:       make(map[string]*asyncTask),
-		mu:          new(sync.RWMutex),
+		mu:          mu,
 		tasksResult: make(map[string][]interface{}),
 		verbose:     verbose[0],
 		sem:         semaphore.NewWeighted(100),
 		wg:          &sync.WaitGroup{},
+		cond:        sync.NewCond(mu),
+		limiter:     NewRateLimiter(0, 0),
+		keys:        newKeyLimiter(),
+		hookMu:      new(sync.Mutex),
 	}
 }
 
@@ -94,57 +144,109 @@ func (a *Async) GetTaskCurNeedDoCount() int {
 	return a.taskNeedDoCount
 }
 
-func (a *Async) addTaskDoingCount() {
+// 释放n个并发数
+func (a *Async) subTaskDoingCount(n int) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	a.taskDoingCount++
+	a.taskDoingCount -= n
+	a.cond.Broadcast()
 }
 
-func (a *Async) subTaskDoingCount() {
+// 唤醒阻塞在cond上的协程
+func (a *Async) broadcast() {
 	a.mu.Lock()
-	defer a.mu.Unlock()
-	a.taskDoingCount--
+	a.cond.Broadcast()
+	a.mu.Unlock()
+}
+
+// ctx被取消时唤醒阻塞在cond上的协程，返回的函数用于停止监听
+func (a *Async) broadcastOnDone(ctx context.Context) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			a.broadcast()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
 }
 
+// 等待直到占用n个并发数后不超过taskParaCountMaxLimit，并占用n个并发数
+//
 // 若传进来的值小于1，则使用默认值
-func (a *Async) wait(taskParaCountMaxLimit int) {
+//
+// ctx被取消时返回ctx.Err()
+func (a *Async) wait(ctx context.Context, taskParaCountMaxLimit int, n int) error {
 	if taskParaCountMaxLimit < 1 {
 		taskParaCountMaxLimit = jasyncConf.TaskMaxLimit
 	}
-	var tmpPreVal int
-	tmpPreVal = -1
-	for {
-		// 如果当前开启的任务数小于配置中设定的最大任务数，则继续开启任务
-		a.mu.RLock()
-		doingTaskCount := a.taskDoingCount
-		//taskCurTotal := a.taskAllTotal
-		taskCurTotal := a.taskCurAllTotal
-		doneCurTaskCount := a.taskCurAllTotal - a.taskCurNeedDoCount
-		a.mu.RUnlock()
-		// 若无变化，则进行下次循环
-		if doingTaskCount == tmpPreVal {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// 如果正在执行的任务数量达到设定的最大并行任务数量限制，则一直等待，直到有任务结束或ctx被取消
+	if a.taskDoingCount+n > taskParaCountMaxLimit && ctx.Done() != nil {
+		stop := a.broadcastOnDone(ctx)
+		defer stop()
+	}
+	for a.taskDoingCount+n > taskParaCountMaxLimit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		//jasyncLog.Infof("达到同时最大任务量限制：taskParaCountMaxLimit: %v,taskDoneCount: %v\r\x1b[K",  taskParaCountMaxLimit,doneCurTaskCount)
+		if a.verbose {
+			jasyncLog.Infof("达到同时最大任务量限制：taskParaCountMaxLimit: %v,taskDoneCount: %v/%v\r", taskParaCountMaxLimit, a.taskCurAllTotal-a.taskCurNeedDoCount, a.taskCurAllTotal)
+		}
+		a.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a.taskDoingCount += n
+	return nil
+}
+
+// SetRateLimit 设置任务开始执行的速率限制，每秒最多开始rate个任务，允许突发burst个，rate<=0表示不限速
+//
+// 可在运行期间调用；重试时每次尝试同样受限
+func (a *Async) SetRateLimit(rate float64, burst int) {
+	a.limiter.SetLimit(rate, burst)
+}
+
+// SetKeyLimit 设置通过WithKey分组的任务的并发数与速率限制，key为空时设置所有未单独设置的key的默认限制
+//
+// 可在运行期间调用，key达到限制时优先派发其他key的任务
+func (a *Async) SetKeyLimit(key string, limit KeyLimit) {
+	a.keys.setLimit(key, limit)
+	a.broadcast()
+}
+
+// KeyStats 获取各key的统计信息，Waiting为处于STATUS_QUEUE的任务数
+func (a *Async) KeyStats() map[string]KeyStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	stats := a.keys.stats()
+	for _, v := range a.order {
+		if v.opt.key == "" || v.TaskStatus.taskStatus != STATUS_QUEUE {
 			continue
 		}
-		tmpPreVal = doingTaskCount
-		//a.mu.RLock()
-		//doneCurTaskCount := a.taskAllTotal-a.taskNeedDoCount
-		//a.mu.RUnlock()
-		// 如果正在执行的任务数量达到设定的最大并行任务数量限制，则一直等待
-		if doingTaskCount < taskParaCountMaxLimit {
-			break
-		} else {
-			//jasyncLog.Infof("达到同时最大任务量限制：taskParaCountMaxLimit: %v,taskDoneCount: %v\r\x1b[K",  taskParaCountMaxLimit,doneCurTaskCount)
-			if a.verbose {
-				jasyncLog.Infof("达到同时最大任务量限制：taskParaCountMaxLimit: %v,taskDoneCount: %v/%v\r", taskParaCountMaxLimit, doneCurTaskCount, taskCurTotal)
-			}
+		st, ok := stats[v.opt.key]
+		if !ok {
+			st.Limit = a.keys.limit(v.opt.key)
 		}
+		st.Waiting++
+		stats[v.opt.key] = st
 	}
+	return stats
 }
 
 type taskStatusStruct struct {
-	taskStatus  int   // 任务状态 0: init,1:queue,2: doing,3: done
+	taskStatus  int   // 任务状态 0: init,1:queue,2: doing,3: done,4: cancel,5: timeout,6: fail,7: skip
 	taskBegTime int64 // 任务开始时间
 	taskEndTime int64 // 任务结束时间
+	taskErr     error // 任务未正常结束的原因，重试时为最后一次的错误
+	attempts    int   // 已执行的次数
 }
 
 // 将毫秒级时间戳转换为时间字符串2006-01-02 15:04:05.000
@@ -156,14 +258,100 @@ func (a *Async) timeStampToStr(nanotimestamp int64) string {
 	return timeStr
 }
 
+// GetTaskStatus 获取某任务的状态，任务不存在时返回-1
+func (a *Async) GetTaskStatus(taskName string) int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	v := a.tasks[taskName]
+	if v == nil {
+		return -1
+	}
+	return v.TaskStatus.taskStatus
+}
+
+// GetTaskError 获取某任务未正常结束的原因
+//
+// 任务函数发生panic时返回*PanicError，超时返回context.DeadlineExceeded，未派发即被取消时返回ctx.Err()，
+// 任务函数最后一个返回值为非nil的error时返回该error
+func (a *Async) GetTaskError(taskName string) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	v := a.tasks[taskName]
+	if v == nil {
+		return nil
+	}
+	return v.TaskStatus.taskErr
+}
+
+// 是否为执行失败的任务
+func isFailed(status int) bool {
+	return status == STATUS_FAIL || status == STATUS_TIMEOUT
+}
+
+// GetTaskErrors 获取所有执行失败(STATUS_FAIL、STATUS_TIMEOUT)的任务的错误
+func (a *Async) GetTaskErrors() map[string]error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	taskErrors := make(map[string]error)
+	for _, v := range a.order {
+		if isFailed(v.TaskStatus.taskStatus) {
+			taskErrors[v.name] = v.TaskStatus.taskErr
+		}
+	}
+	return taskErrors
+}
+
+// FailedTasks 按添加顺序获取所有执行失败(STATUS_FAIL、STATUS_TIMEOUT)的任务名
+func (a *Async) FailedTasks() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	taskNames := make([]string, 0)
+	for _, v := range a.order {
+		if isFailed(v.TaskStatus.taskStatus) {
+			taskNames = append(taskNames, v.name)
+		}
+	}
+	return taskNames
+}
+
+// ResetTasks 将已结束的任务重置为STATUS_INIT，再次调用Run时会重新执行
+//
+// 如: a.ResetTasks(a.FailedTasks()...) 重新执行失败的任务。不存在或未结束的任务会被忽略
+func (a *Async) ResetTasks(taskNames ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, k := range taskNames {
+		v := a.tasks[k]
+		if v == nil || isPending(v.TaskStatus.taskStatus) || v.TaskStatus.taskStatus == STATUS_DOING {
+			continue
+		}
+		v.TaskStatus.taskStatus = STATUS_INIT
+		v.TaskStatus.taskErr = nil
+		v.TaskStatus.attempts = 0
+		v.TaskStatus.taskBegTime = 0
+		v.TaskStatus.taskEndTime = 0
+		v.injected = nil
+		v.outValues = nil
+		v.future = a.newTaskFuture(k, v)
+		delete(a.tasksResult, k)
+		a.journalStatus(v, nil)
+		a.taskNeedDoCount++
+		a.taskCurNeedDoCount++
+		a.taskCurAllTotal++
+	}
+}
+
 // PrintAllTaskStatus 获取执行状态
 // verbose: 详细模式，显示任务的开始结束时间
 // status: 显示指定状态的任务
 // taskName: 显示某任务的状态
 func (a *Async) PrintAllTaskStatus(verbose bool) {
 	// TODO 这里应该可以使用协程并发输出
-	for k, v := range a.tasks {
-		jasyncLog.Infof("%-5s Status:%-10s, Begin:%.24s ,End:%.24s \n", k, a.getDspByCode(v.TaskStatus.taskStatus), a.timeStampToStr(v.TaskStatus.taskBegTime), a.timeStampToStr(v.TaskStatus.taskEndTime))
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	// 按添加顺序输出
+	for _, v := range a.order {
+		a.printTaskStatus(v.name, v.TaskStatus)
 	}
 
 }
@@ -177,14 +365,25 @@ func (a *Async) PrintAllTaskStatus(verbose bool) {
 // taskName: 显示某任务的状态
 func (a *Async) PrintTaskStatus(taskName string, verbose bool) {
 	k := taskName
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	v := a.tasks[k]
 	if v != nil {
-		jasyncLog.Infof("%-5s Status:%-10s, Begin:%.24s ,End:%.24s \n", k, a.getDspByCode(v.TaskStatus.taskStatus), a.timeStampToStr(v.TaskStatus.taskBegTime), a.timeStampToStr(v.TaskStatus.taskEndTime))
+		a.printTaskStatus(k, v.TaskStatus)
 	} else {
 		jasyncLog.Infof("no such task:%s \n", k)
 	}
 }
 
+// 输出任务状态，重试过或失败的任务同时输出执行次数及最后一次的错误
+func (a *Async) printTaskStatus(k string, v *taskStatusStruct) {
+	if v.attempts > 1 || v.taskErr != nil {
+		jasyncLog.Infof("%-5s Status:%-10s, Begin:%.24s ,End:%.24s ,Attempts:%d ,Err:%v \n", k, a.getDspByCode(v.taskStatus), a.timeStampToStr(v.taskBegTime), a.timeStampToStr(v.taskEndTime), v.attempts, v.taskErr)
+		return
+	}
+	jasyncLog.Infof("%-5s Status:%-10s, Begin:%.24s ,End:%.24s \n", k, a.getDspByCode(v.taskStatus), a.timeStampToStr(v.taskBegTime), a.timeStampToStr(v.taskEndTime))
+}
+
 // GetTasksResult 获取所有任务的执行结果
 func (a *Async) GetTasksResult() map[string][]interface{} {
 	a.mu.RLock()
@@ -192,6 +391,19 @@ func (a *Async) GetTasksResult() map[string][]interface{} {
 	return a.tasksResult
 }
 
+// GetTasksResultList 按添加顺序获取所有保存了执行结果的任务的结果
+func (a *Async) GetTasksResultList() []TaskResult {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	results := make([]TaskResult, 0, len(a.tasksResult))
+	for _, v := range a.order {
+		if values, ok := a.tasksResult[v.name]; ok {
+			results = append(results, v.result(values))
+		}
+	}
+	return results
+}
+
 // GetTaskResult 获取任务的某个执行结果
 func (a *Async) GetTaskResult(taskName string) []interface{} {
 	a.mu.RLock()
@@ -201,47 +413,28 @@ func (a *Async) GetTaskResult(taskName string) []interface{} {
 
 // 等待直到全部任务执行完成
 func (a *Async) Wait() {
-	var tmpPreVal int
-	tmpPreVal = -1
-	for {
-		a.mu.RLock()
-		//tmpTaskNeedDoCount := a.taskNeedDoCount
-		tmpTaskCurNeedDoCount := a.taskCurNeedDoCount
-		//tmpTaskAllTotal := a.taskAllTotal
-		tmpTaskCurTotal := a.taskCurAllTotal
-		//doneTaskCount := a.taskAllTotal-a.taskNeedDoCount
-		a.mu.RUnlock()
-		//if tmpTaskNeedDoCount == tmpPreVal {
-		//	continue
-		//}
-		//tmpPreVal = tmpTaskNeedDoCount
-		//if tmpTaskNeedDoCount < 1 {
-		//	break
-		//}
-		if tmpTaskCurNeedDoCount == tmpPreVal {
-			continue
-		}
-		tmpPreVal = tmpTaskCurNeedDoCount
-		if tmpTaskCurNeedDoCount < 1 {
-			break
-		}
-		//time.Sleep(time.Nanosecond * 500)
-		//jasyncLog.Infof("%d/%d\r", tmpTaskAllTotal-tmpTaskNeedDoCount, tmpTaskAllTotal)
-		if a.verbose {
-			jasyncLog.Infof("%d/%d\r", tmpTaskCurTotal-tmpTaskCurNeedDoCount, tmpTaskCurTotal)
+	a.mu.Lock()
+	tmpPreVal := -1
+	prePaused := false
+	for a.taskCurNeedDoCount > 0 {
+		// 任务完成数量或暂停状态变化时输出进度
+		if a.verbose && (a.taskCurNeedDoCount != tmpPreVal || a.paused != prePaused) {
+			jasyncLog.Infof("%d/%d%s%s\r", a.taskCurAllTotal-a.taskCurNeedDoCount, a.taskCurAllTotal, pauseProgress(a.paused), a.limiter.progress())
 		}
+		tmpPreVal = a.taskCurNeedDoCount
+		prePaused = a.paused
+		a.cond.Wait()
 	}
-	a.mu.RLock()
-	//doneTaskCount := a.taskAllTotal - a.taskNeedDoCount
-	doneTaskCurCount := a.taskCurAllTotal - a.taskCurNeedDoCount
-	a.mu.RUnlock()
 	//jasyncLog.Infof("%d/%d,所有task执行完毕\n", doneTaskCount, a.taskAllTotal)
 	if a.verbose {
-		jasyncLog.Infof("%d/%d,所有task执行完毕\n", doneTaskCurCount, a.taskCurAllTotal)
+		jasyncLog.Infof("%d/%d,所有task执行完毕\n", a.taskCurAllTotal-a.taskCurNeedDoCount, a.taskCurAllTotal)
 	}
 	a.taskCurAllTotal = 0
 	a.taskCurNeedDoCount = 0
 	a.taskCurDoingCount = 0
+	a.mu.Unlock()
+	// 等待所有的钩子函数调用完成
+	a.flushHooks()
 }
 
 // 根据code获取对应的状态描述
@@ -255,6 +448,14 @@ func (a *Async) getDspByCode(code int) string {
 		return "doing"
 	case 3:
 		return "done"
+	case 4:
+		return "cancel"
+	case 5:
+		return "timeout"
+	case 6:
+		return "fail"
+	case 7:
+		return "skip"
 	}
 	return "error"
 }
@@ -265,71 +466,9 @@ func (a *Async) getDspByCode(code int) string {
 //
 // handler 任务执行函数，将需要被执行的函数导入到程序中
 //
-// params 任务执行函数所需要的参数
+// params 任务执行函数所需要的参数，其中的TaskOption会被作为任务选项
 func (a *Async) Add(name string, funcHandler interface{}, printHandler interface{}, params ...interface{}) (task_name string, b_success bool, err error) {
-	if name == "" {
-		var err2 error
-		name, err2 = uuid.GenerateUUID()
-		if err2 != nil {
-			return "", false, err2
-		}
-	}
-	task_name = name
-	task := new(asyncTask)
-	// 用来确保key的唯一性
-	a.mu.RLock()
-	// 如果ok表示要添加的任务已经存在
-	_, ok := a.tasks[name]
-	a.mu.RUnlock()
-	if ok {
-		return task_name, false, fmt.Errorf(name + " 任务已存在!")
-	}
-	handlerValue := reflect.ValueOf(funcHandler)
-	// 判断传入的是否为Func类型
-	if handlerValue.Kind() == reflect.Func {
-		// 传入了多少个参数
-		paramNum := len(params)
-		if printHandler != nil && reflect.ValueOf(printHandler).Kind() == reflect.Func {
-			task = &asyncTask{
-				ReqHandler:   handlerValue,
-				PrintHandler: reflect.ValueOf(printHandler),
-				Params:       make([]reflect.Value, paramNum),
-				TaskStatus: &taskStatusStruct{
-					taskStatus:  0,
-					taskBegTime: 0,
-					taskEndTime: 0,
-				},
-				StoreResult: false,
-			}
-		} else {
-			task = &asyncTask{
-				ReqHandler:   handlerValue,
-				PrintHandler: reflect.Value{},
-				Params:       make([]reflect.Value, paramNum),
-				TaskStatus: &taskStatusStruct{
-					taskStatus:  0,
-					taskBegTime: 0,
-					taskEndTime: 0,
-				},
-				StoreResult: false,
-			}
-		}
-		a.mu.Lock()
-		a.tasks[name] = task
-		// 将传入的参数转换成reflect.Value类型
-		if paramNum > 0 {
-			for k, v := range params {
-				a.tasks[name].Params[k] = reflect.ValueOf(v)
-			}
-		}
-		a.taskNeedDoCount++
-		a.taskCurNeedDoCount++
-		a.taskAllTotal++
-		a.taskCurAllTotal++
-		a.mu.Unlock()
-		return task_name, true, nil
-	}
-	return task_name, false, fmt.Errorf(handlerValue.String() + " 不符合格式func(参数...)(返回...){}")
+	return a.add(name, funcHandler, printHandler, false, params...)
 }
 
 // AddR 添加异步执行任务,保存执行结果
@@ -338,144 +477,601 @@ func (a *Async) Add(name string, funcHandler interface{}, printHandler interface
 //
 // handler 任务执行函数，将需要被执行的函数导入到程序中
 //
-// params 任务执行函数所需要的参数
+// params 任务执行函数所需要的参数，其中的TaskOption会被作为任务选项
 func (a *Async) AddR(name string, funcHandler interface{}, printHandler interface{}, params ...interface{}) (task_name string, b_success bool, err error) {
+	return a.add(name, funcHandler, printHandler, true, params...) //231111: false -> true
+}
+
+func (a *Async) add(name string, funcHandler interface{}, printHandler interface{}, storeResult bool, params ...interface{}) (task_name string, b_success bool, err error) {
+	task, err := a.newTask(name, funcHandler, printHandler, storeResult, params...)
+	if err != nil {
+		return task.name, false, err
+	}
+	if err = a.insertTask(task); err != nil {
+		return task.name, false, err
+	}
+	return task.name, true, nil
+}
+
+// 创建任务，出错时返回的任务只有name有效
+func (a *Async) newTask(name string, funcHandler interface{}, printHandler interface{}, storeResult bool, params ...interface{}) (*asyncTask, error) {
 	if name == "" {
 		var err2 error
 		name, err2 = uuid.GenerateUUID()
 		if err2 != nil {
-			return "", false, err2
+			return &asyncTask{}, err2
 		}
 	}
-	task_name = name
-	task := new(asyncTask)
 	// 用来确保key的唯一性
 	a.mu.RLock()
 	// 如果ok表示要添加的任务已经存在
 	_, ok := a.tasks[name]
 	a.mu.RUnlock()
 	if ok {
-		return task_name, false, fmt.Errorf(name + " 任务已存在!")
+		return &asyncTask{name: name}, fmt.Errorf(name + " 任务已存在!")
 	}
 	handlerValue := reflect.ValueOf(funcHandler)
 	// 判断传入的是否为Func类型
-	if handlerValue.Kind() == reflect.Func {
-		// 传入了多少个参数
-		paramNum := len(params)
-		if printHandler != nil && reflect.ValueOf(printHandler).Kind() == reflect.Func {
-			task = &asyncTask{
-				ReqHandler:   handlerValue,
-				PrintHandler: reflect.ValueOf(printHandler),
-				Params:       make([]reflect.Value, paramNum),
-				TaskStatus: &taskStatusStruct{
-					taskStatus:  0,
-					taskBegTime: 0,
-					taskEndTime: 0,
-				},
-				StoreResult: true, //231111: false -> true
-			}
-		} else {
-			task = &asyncTask{
-				ReqHandler:   handlerValue,
-				PrintHandler: reflect.Value{},
-				Params:       make([]reflect.Value, paramNum),
-				TaskStatus: &taskStatusStruct{
-					taskStatus:  0,
-					taskBegTime: 0,
-					taskEndTime: 0,
-				},
-				StoreResult: true, //231111: false -> true
-			}
-		}
-		a.mu.Lock()
-		a.tasks[name] = task
-		// 将传入的参数转换成reflect.Value类型
-		if paramNum > 0 {
-			for k, v := range params {
-				a.tasks[name].Params[k] = reflect.ValueOf(v)
-			}
-		}
-		a.taskNeedDoCount++
-		a.taskCurNeedDoCount++
-		a.taskAllTotal++
-		a.taskCurAllTotal++
-		a.mu.Unlock()
-		return task_name, true, nil
+	if handlerValue.Kind() != reflect.Func {
+		return &asyncTask{name: name}, fmt.Errorf(handlerValue.String() + " 不符合格式func(参数...)(返回...){}")
+	}
+	opt, params := splitOptions(params)
+	// 传入了多少个参数
+	paramNum := len(params)
+	task := &asyncTask{
+		name:         name,
+		ReqHandler:   handlerValue,
+		PrintHandler: reflect.Value{},
+		Params:       make([]reflect.Value, paramNum),
+		TaskStatus: &taskStatusStruct{
+			taskStatus:  0,
+			taskBegTime: 0,
+			taskEndTime: 0,
+		},
+		StoreResult: storeResult,
+		opt:         opt,
+		withCtx:     needContext(handlerValue.Type(), paramNum),
 	}
-	return task_name, false, fmt.Errorf(handlerValue.String() + " 不符合格式func(参数...)(返回...){}")
+	if printHandler != nil && reflect.ValueOf(printHandler).Kind() == reflect.Func {
+		task.PrintHandler = reflect.ValueOf(printHandler)
+	}
+	// 将传入的参数转换成reflect.Value类型
+	for k, v := range params {
+		task.Params[k] = reflect.ValueOf(v)
+	}
+	task.future = a.newTaskFuture(name, task)
+	return task, nil
+}
+
+// 将任务加入任务队列
+func (a *Async) insertTask(task *asyncTask) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	name := task.name
+	if _, ok := a.tasks[name]; ok {
+		return fmt.Errorf(name + " 任务已存在!")
+	}
+	a.tasks[name] = task
+	a.order = append(a.order, task)
+	a.taskNeedDoCount++
+	a.taskCurNeedDoCount++
+	a.taskAllTotal++
+	a.taskCurAllTotal++
+	a.journalAdd(task)
+	a.metrics.submit(task.opt.group)
+	return nil
+}
+
+// SetMetrics 设置记录调度器指标的Metrics
+func (a *Async) SetMetrics(m *Metrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.metrics = m
+}
+
+// AddFuture 添加异步执行任务,保存执行结果,并返回任务的Future
+//
+// 参数同AddR
+func (a *Async) AddFuture(name string, funcHandler interface{}, printHandler interface{}, params ...interface{}) (*Future, error) {
+	taskName, ok, err := a.add(name, funcHandler, printHandler, true, params...)
+	if !ok {
+		return nil, err
+	}
+	return a.GetFuture(taskName), nil
+}
+
+// GetFuture 获取任务的Future，任务不存在时返回nil
+//
+// 通过Add添加的任务不保存执行结果，其Future.Result()返回nil
+func (a *Async) GetFuture(taskName string) *Future {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	v := a.tasks[taskName]
+	if v == nil {
+		return nil
+	}
+	return v.future
+}
+
+func (a *Async) newTaskFuture(name string, task *asyncTask) *Future {
+	f := newFuture(name)
+	f.cancel = func() {
+		a.cancelTask(task)
+	}
+	return f
 }
 
 // 非并发安全
 //
 // Run 任务执行函数
 func (a *Async) Run(taskParaCountMaxLimit int) (bool, error) {
+	return a.RunContext(context.Background(), taskParaCountMaxLimit)
+}
+
+// 非并发安全
+//
+// RunContext 任务执行函数，ctx被取消后不再派发新的任务，
+// 未派发的任务状态被置为STATUS_CANCEL，已派发的任务继续执行
+//
+// 存在通过After设置了前置任务的任务时，Run会等到这些任务都被派发后才返回
+func (a *Async) RunContext(ctx context.Context, taskParaCountMaxLimit int) (bool, error) {
 	if a.taskCurNeedDoCount < 1 {
 		return false, fmt.Errorf("没有需要执行的任务")
 	}
-	// 遍历任务
-	// asyncTaskKey: name,asyncTaskVal:asyncTask
-	for asyncTaskKey, asyncTaskVal := range a.tasks {
-		// 如果任务状态为结束，则进入下一次循环
-		if asyncTaskVal.TaskStatus.taskStatus == STATUS_DONE {
-			continue
+	if taskParaCountMaxLimit < 1 {
+		taskParaCountMaxLimit = jasyncConf.TaskMaxLimit
+	}
+	a.mu.RLock()
+	q := newTaskQueue(a.priorityAging, a.dispatchOrder == ORDER_LIFO)
+	// 检查任务间的依赖关系
+	err := a.checkDeps()
+	a.mu.RUnlock()
+	defer a.fireHooks()
+	if err != nil {
+		// 依赖关系有误时不派发任何任务，未派发的任务置为取消状态，避免Wait一直阻塞
+		a.cancelPending(err)
+		return false, err
+	}
+	// 运行期间新添加的任务同样会被放入队列
+	for {
+		ok, err := a.enqueue(ctx, q)
+		if err != nil {
+			a.cancelPending(err)
+			return false, err
+		}
+		if !ok {
+			break
 		}
-		// 设置任务状态为1: queue
-		asyncTaskVal.TaskStatus.taskStatus = STATUS_QUEUE
 		// 等待，直到当前开启的任务数小于配置中设定的最大任务数，则继续开启任务
-		a.wait(taskParaCountMaxLimit)
-		a.addTaskDoingCount()
+		if err := a.wait(ctx, taskParaCountMaxLimit, 1); err != nil {
+			a.cancelPending(err)
+			return false, err
+		}
+		// 等待期间可能有新的任务加入，取出此时优先级最高且其key未达到限制的任务
+		asyncTaskVal, err := a.next(ctx, q)
+		if err != nil {
+			a.subTaskDoingCount(1)
+			a.cancelPending(err)
+			return false, err
+		}
+		if asyncTaskVal == nil {
+			a.subTaskDoingCount(1)
+			continue
+		}
+		ok, err = a.admitTask(ctx, asyncTaskVal, taskParaCountMaxLimit)
+		if err != nil {
+			a.cancelPending(err)
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+		taskCtx, ok := a.startTask(ctx, asyncTaskVal)
+		if !ok {
+			a.releaseTask(asyncTaskVal)
+			continue
+		}
+		a.fireHooks()
 		// 开启携程，执行任务
-		go func(taskName string, task *asyncTask) {
-			taskResult := make([]interface{}, 0)
-			defer func(taskName2 string) {
-				// 设置任务的状态为结束
-				task.TaskStatus.taskStatus = STATUS_DONE
-				// 设置任务结束时间戳，毫秒
-				task.TaskStatus.taskEndTime = time.Now().UnixNano()
-				// 任务数量减一
-				a.subTaskDoingCount()
-			}(taskName)
-			// 设置任务状态为2: doing
-			task.TaskStatus.taskStatus = STATUS_DOING
-			// 设置任务开始时间戳，毫秒
-			task.TaskStatus.taskBegTime = time.Now().UnixNano()
-			// 调用传入的函数
-			values := task.ReqHandler.Call(task.Params)
-			// 传入的函数执行的结果保存在values中
-			if valuesNum := len(values); valuesNum > 0 {
-				resultItems := make([]interface{}, valuesNum)
-				// asyncTaskKey:int,asyncTaskVal:value
-				for k, v := range values {
-					resultItems[k] = v.Interface()
-				}
-				taskResult = resultItems
-				// 如果传入了printHandler,并且reqHandler函数返回参数的个数与printHandler函数形参个数相同
-				if a.tasks[taskName].PrintHandler.IsValid() && a.tasks[taskName].ReqHandler.Type().NumOut() == a.tasks[taskName].PrintHandler.Type().NumIn() {
-					paramsArg := make([]reflect.Value, len(taskResult))
-					for k, v := range taskResult {
-						if reflect.ValueOf(v).IsValid() {
-							paramsArg[k] = reflect.ValueOf(v)
-						} else {
-							paramsArg[k] = reflect.Zero(a.tasks[taskName].PrintHandler.Type().In(k))
-						}
-					}
-					// 调用printHandler
-					a.tasks[taskName].PrintHandler.Call(paramsArg)
+		go a.runTask(taskCtx, taskParaCountMaxLimit, asyncTaskVal.name, asyncTaskVal)
+	}
+	return true, nil
+}
+
+// 按任务的权重占用其余的并发数并获取其需要的资源，然后等待限速，失败时释放已占用的key的并发数、并发数及资源
+//
+// 等待期间不派发其他任务，避免权重或资源需求大的任务饥饿。
+// 任务的权重或资源需求超过容量时，该任务被置为STATUS_FAIL并返回false
+func (a *Async) admitTask(ctx context.Context, task *asyncTask, taskParaCountMaxLimit int) (bool, error) {
+	weight := int(task.opt.cost())
+	err := checkWeight(task.name, int64(weight), int64(taskParaCountMaxLimit))
+	if err == nil {
+		err = checkResources(a.resources, task.name, task.opt.demand)
+	}
+	if err != nil {
+		a.keys.release(task.opt.key)
+		a.subTaskDoingCount(1)
+		a.mu.Lock()
+		a.finishPendingTask(task, STATUS_FAIL, err)
+		a.mu.Unlock()
+		a.fireHooks()
+		return false, nil
+	}
+	held := 1
+	if weight > 1 {
+		err = a.wait(ctx, taskParaCountMaxLimit, weight-1)
+	}
+	if err == nil {
+		held = weight
+		err = acquireResources(ctx, a.resources, task.opt.demand)
+		if err == nil {
+			if err = a.limiter.Wait(ctx); err != nil {
+				releaseResources(a.resources, task.opt.demand)
+			}
+		}
+	}
+	if err != nil {
+		a.keys.release(task.opt.key)
+		a.subTaskDoingCount(held)
+		return false, err
+	}
+	return true, nil
+}
+
+// 任务重试等待结束后重新占用key的并发数、并发数及资源，并等待限速
+func (a *Async) reacquireTask(ctx context.Context, task *asyncTask, taskParaCountMaxLimit int) error {
+	if err := a.keys.acquire(ctx, task.opt.key); err != nil {
+		return err
+	}
+	weight := int(task.opt.cost())
+	err := a.wait(ctx, taskParaCountMaxLimit, weight)
+	if err == nil {
+		if err = acquireResources(ctx, a.resources, task.opt.demand); err != nil {
+			a.subTaskDoingCount(weight)
+		}
+	}
+	if err != nil {
+		a.keys.release(task.opt.key)
+		return err
+	}
+	if err = a.limiter.Wait(ctx); err != nil {
+		a.releaseTask(task)
+		return err
+	}
+	return nil
+}
+
+// 释放任务占用的key的并发数、资源及并发数
+func (a *Async) releaseTask(task *asyncTask) {
+	a.keys.release(task.opt.key)
+	releaseResources(a.resources, task.opt.demand)
+	a.subTaskDoingCount(int(task.opt.cost()))
+}
+
+// 将尚未派发的任务放入派发队列，并丢弃队首已被取消的任务
+//
+// 队列为空但仍有任务在等待前置任务，或已暂停派发时一直等待，直到有任务可以派发或ctx被取消。
+// 返回队列中是否还有需要派发的任务
+func (a *Async) enqueue(ctx context.Context, q *taskQueue) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var stop func()
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+	}()
+	for {
+		a.enqueueLocked(q)
+		for q.ready.Len() > 0 && q.peek().TaskStatus.taskStatus != STATUS_QUEUE {
+			q.pop()
+		}
+		// 暂停期间在此等待恢复，此时不占用并发数，正在重试的任务仍可重新获取并发数
+		if q.Len() > 0 && !a.paused {
+			return true, nil
+		}
+		if q.Len() == 0 {
+			if len(q.blocked) == 0 {
+				return false, nil
+			}
+			// 没有正在执行的任务时，等待中的任务的前置任务永远不会结束
+			if a.taskNeedDoCount <= len(q.blocked) {
+				for _, v := range q.blocked {
+					a.finishPendingTask(v, STATUS_SKIP, fmt.Errorf("前置任务无法执行"))
 				}
+				q.blocked = nil
+				return false, nil
 			}
+		}
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if stop == nil && ctx.Done() != nil {
+			stop = a.broadcastOnDone(ctx)
+		}
+		a.cond.Wait()
+	}
+}
 
-			a.mu.Lock()
-			// 210519: 如果使用AddR, 则添加每个任务执行的结果
-			if a.tasks[taskName].StoreResult {
-				a.tasksResult[taskName] = taskResult
+// 取出下一个可以派发的任务，并占用其key的一个并发数
+//
+// 队列中的任务的key都达到限制时一直等待，直到有任务可以派发或ctx被取消；队列为空或已暂停派发时返回nil
+func (a *Async) next(ctx context.Context, q *taskQueue) (*asyncTask, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var stop func()
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+	}()
+	for {
+		a.enqueueLocked(q)
+		// 暂停期间不派发任务，任务保持STATUS_QUEUE，由enqueue等待恢复
+		if a.paused {
+			return nil, nil
+		}
+		task, d := q.popReady(a.keys)
+		if task != nil {
+			return task, nil
+		}
+		if q.Len() == 0 {
+			return nil, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if stop == nil && ctx.Done() != nil {
+			stop = a.broadcastOnDone(ctx)
+		}
+		// 等待有任务结束、key生成新的令牌或暂停派发
+		var timer *time.Timer
+		if d > 0 {
+			timer = time.AfterFunc(d, a.broadcast)
+		}
+		a.cond.Wait()
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// 同enqueue，需持有写锁
+func (a *Async) enqueueLocked(q *taskQueue) {
+	if q.scanned > len(a.order) {
+		q.scanned = 0
+	}
+	for _, v := range a.order[q.scanned:] {
+		if !isPending(v.TaskStatus.taskStatus) {
+			continue
+		}
+		// 设置任务状态为1: queue
+		v.TaskStatus.taskStatus = STATUS_QUEUE
+		v.future.setStatus(STATUS_QUEUE)
+		a.journalStatus(v, nil)
+		a.metrics.queue(v.opt.group, 1)
+		a.emitHook(hookQueued, v, nil)
+		a.keepDeps(v)
+		q.blocked = append(q.blocked, v)
+	}
+	q.scanned = len(a.order)
+	// 前置任务都已完成的任务放入队列，前置任务未成功执行的任务被跳过
+	now := time.Now().UnixNano()
+	blocked := q.blocked[:0]
+	for _, v := range q.blocked {
+		if v.TaskStatus.taskStatus != STATUS_QUEUE {
+			continue
+		}
+		ready, err := a.depsReady(v)
+		switch {
+		case err != nil:
+			a.finishPendingTask(v, STATUS_SKIP, err)
+		case !ready:
+			blocked = append(blocked, v)
+		default:
+			if err = a.inject(v); err != nil {
+				a.finishPendingTask(v, STATUS_FAIL, err)
+				continue
 			}
-			a.taskNeedDoCount--
-			a.taskCurNeedDoCount--
-			a.mu.Unlock()
-			return
-		}(asyncTaskKey, asyncTaskVal)
+			q.push(v, now)
+		}
+	}
+	for i := len(blocked); i < len(q.blocked); i++ {
+		q.blocked[i] = nil
+	}
+	q.blocked = blocked
+}
+
+// 将任务状态置为2: doing，并创建任务执行期间使用的ctx
+//
+// 等待期间任务可能已通过Future被取消，此时返回false
+func (a *Async) startTask(ctx context.Context, task *asyncTask) (context.Context, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if task.TaskStatus.taskStatus != STATUS_QUEUE {
+		return nil, false
+	}
+	ctx, task.cancel = context.WithCancel(ctx)
+	// 设置任务状态为2: doing
+	task.TaskStatus.taskStatus = STATUS_DOING
+	// 设置任务开始时间戳，毫秒
+	task.TaskStatus.taskBegTime = time.Now().UnixNano()
+	task.future.setStatus(STATUS_DOING)
+	a.journalStatus(task, nil)
+	a.metrics.queue(task.opt.group, -1)
+	wait := time.Duration(task.TaskStatus.taskBegTime - task.queueTime)
+	a.metrics.start(task.opt.group, wait)
+	ctx, task.span = startSpan(a.tracer, ctx, task.name, task.opt, wait)
+	a.emitHook(hookStart, task, nil)
+	return ctx, true
+}
+
+// 执行任务，并记录任务的状态与结果
+//
+// taskParaCountMaxLimit 任务重试时重新占用并发数使用
+func (a *Async) runTask(ctx context.Context, taskParaCountMaxLimit int, taskName string, task *asyncTask) {
+	var taskResult []interface{}
+	var taskErr error
+	var values []reflect.Value
+	status := STATUS_DONE
+	// 重试等待期间被取消时，并发数已被释放
+	held := true
+	defer func() {
+		// printHandler发生panic时，任务同样视为失败
+		if r := recover(); r != nil {
+			taskErr = newPanicError(r)
+			status = STATUS_FAIL
+		}
+		// ctx被取消的任务
+		if status != STATUS_DONE && ctx.Err() == context.Canceled {
+			status = STATUS_CANCEL
+		}
+		status, taskErr = task.future.finalStatus(status, taskErr)
+		// 先释放任务占用的key的并发数、资源及并发数，Wait返回时任务不再占用它们
+		if held {
+			a.releaseTask(task)
+		}
+		a.mu.Lock()
+		// 设置任务的状态为结束
+		task.TaskStatus.taskStatus = status
+		task.TaskStatus.taskErr = taskErr
+		// 设置任务结束时间戳，毫秒
+		task.TaskStatus.taskEndTime = time.Now().UnixNano()
+		// 210519: 如果使用AddR, 则添加每个任务执行的结果
+		if task.StoreResult && taskResult != nil {
+			a.tasksResult[taskName] = taskResult
+		}
+		if task.keep && status == STATUS_DONE {
+			task.outValues = values
+		}
+		a.journalStatus(task, taskResult)
+		a.metrics.finish(task.opt.group, status, time.Duration(task.TaskStatus.taskEndTime-task.TaskStatus.taskBegTime))
+		a.emitHook(hookFinish, task, taskResult)
+		span := task.span
+		task.span = nil
+		task.cancel()
+		task.cancel = nil
+		a.taskNeedDoCount--
+		a.taskCurNeedDoCount--
+		if task.StoreResult {
+			task.future.finish(status, taskResult, taskErr)
+		} else {
+			task.future.finish(status, nil, taskErr)
+		}
+		a.emitResult(task, taskResult)
+		a.cond.Broadcast()
+		a.mu.Unlock()
+		endSpan(span, status, taskErr)
+		a.fireHooks()
+	}()
+	invoke := a.invoker()
+	// 注入的前置任务的返回值位于实参之前
+	params := task.Params
+	if task.injected != nil {
+		params = append(append(make([]reflect.Value, 0, len(task.injected)+len(params)), task.injected...), params...)
+	}
+	// 调用传入的函数，失败时按重试策略重试
+	status, held, taskErr = retryRun(ctx, task.opt.retry, func(attempt int) (int, error) {
+		var err error
+		values, err = callHandler(ctx, task.opt, invoke, taskName, task.ReqHandler, task.withCtx, params)
+		status := statusOfErr(err)
+		// 任务函数最后一个返回值为非nil的error时，任务视为失败
+		if err == nil {
+			if err = lastError(values); err != nil {
+				status = STATUS_FAIL
+			}
+		}
+		a.mu.Lock()
+		task.TaskStatus.attempts = attempt
+		task.TaskStatus.taskErr = err
+		a.mu.Unlock()
+		return status, err
+	}, func() {
+		a.releaseTask(task)
+	}, func(ctx context.Context) error {
+		return a.reacquireTask(ctx, task, taskParaCountMaxLimit)
+	})
+	// 超时或panic时没有返回值
+	if values == nil {
+		return
+	}
+	// 传入的函数执行的结果保存在values中
+	taskResult = valuesToInterfaces(values)
+	callPrintHandler(task.ReqHandler, task.PrintHandler, taskResult)
+}
+
+// SetDispatchOrder 设置Run派发任务的顺序，ORDER_FIFO(默认)或ORDER_LIFO
+//
+// 优先级(WithPriority)不同时，优先派发优先级高的任务
+func (a *Async) SetDispatchOrder(order int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.dispatchOrder = order
+}
+
+// SetPriorityAging 设置任务优先级的老化时长
+//
+// 任务在派发队列中每等待d，其优先级相当于提升1，避免低优先级任务一直得不到执行；d<=0表示不提升(默认)。
+// 优先级相同时，较早的d时段内入队的任务先出队，同一时段内入队的任务按SetDispatchOrder的顺序出队
+func (a *Async) SetPriorityAging(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.priorityAging = d
+}
+
+// 是否为尚未派发的任务
+func isPending(status int) bool {
+	return status == STATUS_INIT || status == STATUS_QUEUE
+}
+
+// 将所有未派发的任务置为取消状态，并从需要执行的任务数量中减去
+func (a *Async) cancelPending(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, v := range a.order {
+		if isPending(v.TaskStatus.taskStatus) {
+			a.cancelPendingTask(v, err)
+		}
+	}
+}
+
+// 将未派发的任务置为取消状态，需持有写锁
+func (a *Async) cancelPendingTask(task *asyncTask, err error) {
+	a.finishPendingTask(task, STATUS_CANCEL, err)
+}
+
+// 结束未派发的任务，需持有写锁
+func (a *Async) finishPendingTask(task *asyncTask, status int, err error) {
+	if task.TaskStatus.taskStatus == STATUS_QUEUE {
+		a.metrics.queue(task.opt.group, -1)
+	}
+	a.metrics.discard(task.opt.group, status)
+	task.TaskStatus.taskStatus = status
+	task.TaskStatus.taskErr = err
+	task.TaskStatus.taskEndTime = time.Now().UnixNano()
+	a.taskNeedDoCount--
+	a.taskCurNeedDoCount--
+	task.future.finish(status, nil, err)
+	a.journalStatus(task, nil)
+	a.emitHook(hookFinish, task, nil)
+	a.emitResult(task, nil)
+	a.cond.Broadcast()
+}
+
+// 取消任务：尚未派发的任务置为取消状态，正在执行的任务取消其ctx
+func (a *Async) cancelTask(task *asyncTask) {
+	a.mu.Lock()
+	if isPending(task.TaskStatus.taskStatus) {
+		a.cancelPendingTask(task, context.Canceled)
+		a.mu.Unlock()
+		a.fireHooks()
+		return
+	}
+	cancel := task.cancel
+	a.mu.Unlock()
+	if cancel != nil {
+		cancel()
 	}
-	return true, nil
 }
 
 // Clean 清空任务队列.
@@ -485,6 +1081,7 @@ func (a *Async) Clean() {
 	a.taskCurNeedDoCount = 0
 	a.taskCurAllTotal = 0
 	a.tasks = make(map[string]*asyncTask)
+	a.order = nil
 }
 
 var jasyncLog = jlog.New(jlog.LogConfig{
@@ -0,0 +1,118 @@
+package jasync
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// 检查未派发任务的依赖关系：前置任务须存在，且依赖不能成环，需持有锁
+func (a *Async) checkDeps() error {
+	// 0: 未访问，1: 访问中，2: 已访问
+	state := make(map[string]int)
+	path := make([]string, 0)
+	var visit func(task *asyncTask) error
+	visit = func(task *asyncTask) error {
+		switch state[task.name] {
+		case 1:
+			for k, v := range path {
+				if v == task.name {
+					return fmt.Errorf("任务依赖存在环: %s -> %s", strings.Join(path[k:], " -> "), task.name)
+				}
+			}
+		case 2:
+			return nil
+		}
+		state[task.name] = 1
+		path = append(path, task.name)
+		for _, name := range task.opt.after {
+			dep := a.tasks[name]
+			if dep == nil {
+				return fmt.Errorf("任务 %s 的前置任务 %s 不存在", task.name, name)
+			}
+			// 已结束的任务不会再次执行
+			if !isPending(dep.TaskStatus.taskStatus) {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[task.name] = 2
+		return nil
+	}
+	for _, v := range a.order {
+		if isPending(v.TaskStatus.taskStatus) {
+			if err := visit(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 任务的前置任务是否都已完成，前置任务未成功执行时返回error，需持有锁
+func (a *Async) depsReady(task *asyncTask) (bool, error) {
+	ready := true
+	for _, name := range task.opt.after {
+		dep := a.tasks[name]
+		// 运行期间添加的任务，其前置任务可能尚未添加
+		if dep == nil {
+			ready = false
+			continue
+		}
+		switch status := dep.TaskStatus.taskStatus; {
+		case status == STATUS_DONE:
+		case isPending(status) || status == STATUS_DOING:
+			ready = false
+		default:
+			return false, fmt.Errorf("前置任务 %s 未成功执行: %s", name, a.getDspByCode(status))
+		}
+	}
+	return ready, nil
+}
+
+// 需要注入返回值时，令前置任务保留其返回值，需持有写锁
+func (a *Async) keepDeps(task *asyncTask) {
+	if !task.opt.inject {
+		return
+	}
+	for _, name := range task.opt.after {
+		if dep := a.tasks[name]; dep != nil {
+			dep.keep = true
+		}
+	}
+}
+
+// 将前置任务的返回值注入到任务中，需持有写锁
+func (a *Async) inject(task *asyncTask) error {
+	if !task.opt.inject {
+		return nil
+	}
+	handlerType := task.ReqHandler.Type()
+	injected := make([]reflect.Value, 0)
+	for _, name := range task.opt.after {
+		dep := a.tasks[name]
+		values := dep.outValues
+		// 前置任务在之前的Run中已完成，且未保留返回值时，使用保存的执行结果
+		if values == nil && dep.ReqHandler.Type().NumOut() > 0 {
+			result, ok := a.tasksResult[name]
+			if !ok {
+				return fmt.Errorf("前置任务 %s 的返回值未保存", name)
+			}
+			values = make([]reflect.Value, len(result))
+			for k, v := range result {
+				values[k] = reflect.ValueOf(v)
+				// nil值使用前置任务返回值类型的零值
+				if v == nil {
+					values[k] = reflect.Zero(dep.ReqHandler.Type().Out(k))
+				}
+			}
+		}
+		injected = append(injected, values...)
+	}
+	task.injected = injected
+	task.withCtx = needContext(handlerType, len(injected)+len(task.Params))
+	return nil
+}
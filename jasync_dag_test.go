@@ -0,0 +1,78 @@
+package jasync
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsync_After(t *testing.T) {
+	a := New(false)
+	started := make(chan string, 10)
+	add := func(name string, d time.Duration, fail bool, opts ...interface{}) {
+		a.AddR(name, func() (string, error) {
+			started <- name
+			time.Sleep(d)
+			if fail {
+				return "", fmt.Errorf("%s failed", name)
+			}
+			return name, nil
+		}, nil, opts...)
+	}
+	add("c", 0, false, After("a", "b"))
+	add("a", 50*time.Millisecond, false)
+	add("b", 20*time.Millisecond, false)
+	add("d", 0, true, After("a"))
+	add("e", 0, false, After("d"))
+	add("f", 0, false, After("e"))
+	// 前置任务的全部返回值依次注入
+	a.AddR("g", func(a string, errA error, c string, errC error, s string) string {
+		return fmt.Sprint(a, errA, c, errC, s)
+	}, nil, AfterWithResults("a", "c"), "!")
+	if ok, err := a.Run(10); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	a.Wait()
+	close(started)
+	order := ""
+	for name := range started {
+		order += name
+	}
+	// c在a、b之后执行，d在a之后执行，d失败后e、f被跳过
+	if len(order) != 4 || strings.Index(order, "c") < 2 || strings.Index(order, "d") < 1 || strings.IndexAny(order, "ab") > 1 {
+		t.Fatalf("order: %v", order)
+	}
+	for name, status := range map[string]int{"c": STATUS_DONE, "d": STATUS_FAIL, "e": STATUS_SKIP, "f": STATUS_SKIP, "g": STATUS_DONE} {
+		if a.GetTaskStatus(name) != status {
+			t.Fatalf("%s: %d,%v", name, a.GetTaskStatus(name), a.GetTaskError(name))
+		}
+	}
+	if r := a.GetTaskResult("g"); len(r) != 1 || r[0] != "a<nil>c<nil>!" {
+		t.Fatalf("g result: %v", r)
+	}
+}
+
+func TestAsync_AfterCycle(t *testing.T) {
+	a := New(false)
+	a.Add("t1", func() {}, nil, After("t3"))
+	a.Add("t2", func() {}, nil, After("t1"))
+	a.Add("t3", func() {}, nil, After("t2"))
+	if _, err := a.Run(2); err == nil || !strings.Contains(err.Error(), "t1 -> t3 -> t2 -> t1") {
+		t.Fatalf("err: %v", err)
+	}
+	// 未派发的任务被取消，Wait不会阻塞
+	a.Wait()
+	if s := a.GetTaskStatus("t1"); s != STATUS_CANCEL {
+		t.Fatalf("t1 status: %d", s)
+	}
+	a = New(false)
+	a.Add("t1", func() {}, nil, After("t0"))
+	if _, err := a.Run(2); err == nil {
+		t.Fatal("missing dependency")
+	}
+	a.Wait()
+	if s := a.GetTaskStatus("t1"); s != STATUS_CANCEL {
+		t.Fatalf("t1 status: %d", s)
+	}
+}
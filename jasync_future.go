@@ -0,0 +1,118 @@
+package jasync
+
+import (
+	"context"
+	"sync"
+)
+
+// Future 任务的句柄，用于在任务结束时立即获取其结果，而不必等待整批任务结束
+//
+// 用法同context.Context: 等待Done()返回的channel被关闭后，通过Result()、Err()获取结果
+type Future struct {
+	name   string
+	done   chan struct{}
+	mu     sync.RWMutex
+	status int
+	values []interface{}
+	err    error
+	cancel func() // 由任务所属的对象设置，用于取消任务
+	// 是否调用过Cancel
+	canceled bool
+}
+
+func newFuture(name string) *Future {
+	return &Future{
+		name: name,
+		done: make(chan struct{}),
+	}
+}
+
+// Name 获取任务名
+func (f *Future) Name() string {
+	return f.name
+}
+
+// Done 任务结束(包括失败、超时、取消)时被关闭
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result 获取任务函数的返回值，任务未结束时返回nil
+func (f *Future) Result() []interface{} {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.values
+}
+
+// Err 获取任务未正常结束的原因，任务未结束或正常结束时返回nil
+func (f *Future) Err() error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.err
+}
+
+// Status 获取任务状态
+func (f *Future) Status() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.status
+}
+
+// Cancel 取消任务
+//
+// 尚未派发的任务不再执行；已开始执行的任务通过ctx通知任务函数，任务函数返回后才会结束，
+// 此时无论任务函数是否正常返回，任务状态均为STATUS_CANCEL
+func (f *Future) Cancel() {
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+	f.mu.Lock()
+	f.canceled = true
+	cancel := f.cancel
+	f.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (f *Future) setStatus(status int) {
+	f.mu.Lock()
+	f.status = status
+	f.mu.Unlock()
+}
+
+// 是否调用过Cancel
+func (f *Future) wasCanceled() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.canceled
+}
+
+// 获取任务结束时的状态：通过Cancel取消的任务为STATUS_CANCEL
+func (f *Future) finalStatus(status int, err error) (int, error) {
+	if f == nil || !f.wasCanceled() {
+		return status, err
+	}
+	if err == nil {
+		err = context.Canceled
+	}
+	return STATUS_CANCEL, err
+}
+
+// 记录任务结束时的状态与结果，并关闭done
+func (f *Future) finish(status int, values []interface{}, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+	f.status = status
+	f.values = values
+	f.err = err
+	f.cancel = nil
+	close(f.done)
+}
@@ -0,0 +1,112 @@
+package jasync
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsync_AddFuture(t *testing.T) {
+	a := New(false)
+	var called int32
+	f1, _ := a.AddFuture("t1", func() string {
+		return "t1"
+	}, nil)
+	f2, _ := a.AddFuture("t2", func() {
+		time.Sleep(100 * time.Millisecond)
+	}, nil)
+	f3, _ := a.AddFuture("t3", func() {
+		atomic.AddInt32(&called, 1)
+	}, nil)
+	f4, _ := a.AddFuture("t4", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil)
+	if f1.Status() != STATUS_INIT || f1.Result() != nil {
+		t.Fatalf("t1 before run: %d", f1.Status())
+	}
+	// 取消尚未派发的任务
+	f3.Cancel()
+	go func() {
+		<-f1.Done()
+		// 取消正在执行的任务
+		time.Sleep(20 * time.Millisecond)
+		f4.Cancel()
+	}()
+	a.Run(4)
+	select {
+	case <-f4.Done():
+	case <-f2.Done():
+		t.Fatal("t4 should be done before t2")
+	}
+	a.Wait()
+	if r := f1.Result(); f1.Status() != STATUS_DONE || len(r) != 1 || r[0] != "t1" {
+		t.Fatalf("t1: %d,%v", f1.Status(), r)
+	}
+	if f3.Status() != STATUS_CANCEL || f3.Err() != context.Canceled || called != 0 || a.GetTaskStatus("t3") != STATUS_CANCEL {
+		t.Fatalf("t3: %d,%v,%d", f3.Status(), f3.Err(), called)
+	}
+	if f4.Status() != STATUS_CANCEL || f4.Err() != context.Canceled {
+		t.Fatalf("t4: %d,%v", f4.Status(), f4.Err())
+	}
+	if a.GetFuture("t2") != f2 || f2.Status() != STATUS_DONE {
+		t.Fatalf("t2: %d", f2.Status())
+	}
+}
+
+func TestAsync_ARFuture(t *testing.T) {
+	a := NewAR(2)
+	f1, err := a.AddAndRunFuture("t1", func(i int) int {
+		return i * 2
+	}, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, _ := a.Init("t2").CAdd(func(i int) int {
+		return i + 1
+	}, 1).CAdd(func(i int) (string, int) {
+		return "t2", i
+	}).CDOFuture()
+	<-f1.Done()
+	<-f2.Done()
+	if r := f1.Result(); len(r) != 1 || r[0] != 4 {
+		t.Fatalf("t1: %v", r)
+	}
+	if r := f2.Result(); f2.Name() != "t2" || len(r) != 2 || r[0] != "t2" || r[1] != 2 {
+		t.Fatalf("t2: %v", r)
+	}
+	f3, _ := a.AddAndRunFuture("t3", func(ctx context.Context) {
+		<-ctx.Done()
+	}, nil)
+	f3.Cancel()
+	<-f3.Done()
+	if f3.Status() != STATUS_CANCEL {
+		t.Fatalf("t3: %d", f3.Status())
+	}
+	a.Wait()
+}
+
+func TestAsync_ARFutureRelease(t *testing.T) {
+	a := NewAR(2)
+	a.SetResources(NewMultiWeighted(Resources{"conns": 1}))
+	// 任务结束时信号量与资源已释放
+	var held int64
+	a.OnFinish(func(TaskResult) {
+		atomic.AddInt64(&held, a.sem.GetCur()+a.resources.GetCur()["conns"])
+	})
+	for i := 0; i < 10; i++ {
+		f, err := a.AddAndRunFuture("t", func() {}, nil, WithWeight(2), WithResources(Resources{"conns": 1}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-f.Done()
+		if cur := a.sem.GetCur(); cur != 0 {
+			t.Fatalf("round %d: sem %d", i, cur)
+		}
+	}
+	a.Wait()
+	if held != 0 {
+		t.Fatalf("held on finish: %d", held)
+	}
+}
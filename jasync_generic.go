@@ -0,0 +1,122 @@
+package jasync
+
+import (
+	"context"
+	"fmt"
+)
+
+// Handle 通过Submit、SubmitAR添加的任务的句柄，在Future的基础上提供类型安全的执行结果
+type Handle[T any] struct {
+	*Future
+}
+
+// Result 获取任务第一个返回值及任务的错误
+//
+// 任务未结束或第一个返回值的类型不是T(如被中间件替换)时返回错误
+func (h *Handle[T]) Result() (T, error) {
+	var zero T
+	select {
+	case <-h.Done():
+	default:
+		return zero, fmt.Errorf("任务未结束:%s", h.Name())
+	}
+	values := h.Future.Result()
+	if len(values) == 0 || values[0] == nil {
+		return zero, h.Err()
+	}
+	v, ok := values[0].(T)
+	if !ok {
+		return zero, fmt.Errorf("任务%s的返回值类型为%T，不是%T", h.Name(), values[0], zero)
+	}
+	return v, h.Err()
+}
+
+// Submit 添加类型安全的异步执行任务，保存执行结果
+//
+// name 任务名，若不填，则生成UUID
+//
+// fn 任务执行函数，返回非nil的error时任务视为失败
+//
+// opts 任务选项，如WithTimeout、WithRetry
+func Submit[T any](a *Async, name string, fn func() (T, error), opts ...TaskOption) (*Handle[T], error) {
+	return submit[T](a, name, fn, opts)
+}
+
+// SubmitContext 同Submit，fn会收到任务的ctx，ctx在Run的ctx被取消或任务超时时结束
+func SubmitContext[T any](a *Async, name string, fn func(ctx context.Context) (T, error), opts ...TaskOption) (*Handle[T], error) {
+	return submit[T](a, name, fn, opts)
+}
+
+func submit[T any](a *Async, name string, fn interface{}, opts []TaskOption) (*Handle[T], error) {
+	params := make([]interface{}, len(opts))
+	for k, v := range opts {
+		params[k] = v
+	}
+	taskName, ok, err := a.add(name, fn, nil, true, params...)
+	if !ok {
+		return nil, err
+	}
+	return &Handle[T]{Future: a.GetFuture(taskName)}, nil
+}
+
+// GetResult 获取任务第一个返回值及任务的错误
+//
+// 任务不存在、未结束或第一个返回值的类型不是T时返回错误；只有通过AddR、Submit添加的任务才会保存执行结果
+func GetResult[T any](a *Async, taskName string) (T, error) {
+	var zero T
+	a.mu.RLock()
+	task := a.tasks[taskName]
+	result, ok := a.tasksResult[taskName]
+	a.mu.RUnlock()
+	if task == nil {
+		return zero, fmt.Errorf("no such task:%s", taskName)
+	}
+	status := a.GetTaskStatus(taskName)
+	if isPending(status) || status == STATUS_DOING {
+		return zero, fmt.Errorf("任务未结束:%s", taskName)
+	}
+	taskErr := a.GetTaskError(taskName)
+	if !ok || len(result) == 0 {
+		if taskErr != nil {
+			return zero, taskErr
+		}
+		return zero, fmt.Errorf("任务没有保存执行结果:%s", taskName)
+	}
+	// 返回值为nil的接口、指针等
+	if result[0] == nil {
+		return zero, taskErr
+	}
+	v, ok := result[0].(T)
+	if !ok {
+		return zero, fmt.Errorf("任务%s的返回值类型为%T，不是%T", taskName, result[0], zero)
+	}
+	return v, taskErr
+}
+
+// SubmitAR 添加类型安全的任务并立即执行，达到最大并发数时阻塞
+//
+// printHandler 任务函数返回后调用，可为nil
+func SubmitAR[T any](ar *AsyncRealtime, name string, fn func() (T, error), printHandler func(T, error), opts ...TaskOption) (*Handle[T], error) {
+	return submitAR(ar, name, fn, printHandler, opts)
+}
+
+// SubmitARContext 同SubmitAR，fn会收到任务的ctx
+func SubmitARContext[T any](ar *AsyncRealtime, name string, fn func(ctx context.Context) (T, error), printHandler func(T, error), opts ...TaskOption) (*Handle[T], error) {
+	return submitAR(ar, name, fn, printHandler, opts)
+}
+
+func submitAR[T any](ar *AsyncRealtime, name string, fn interface{}, printHandler func(T, error), opts []TaskOption) (*Handle[T], error) {
+	params := make([]interface{}, len(opts))
+	for k, v := range opts {
+		params[k] = v
+	}
+	var handler interface{}
+	if printHandler != nil {
+		handler = printHandler
+	}
+	f, err := ar.AddAndRunFuture(name, fn, handler, params...)
+	if err != nil {
+		return nil, err
+	}
+	return &Handle[T]{Future: f}, nil
+}
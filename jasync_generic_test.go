@@ -0,0 +1,85 @@
+package jasync
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmit(t *testing.T) {
+	a := New(false)
+	h1, err := Submit(&a, "t1", func() (string, error) {
+		return "t1", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, _ := Submit(&a, "t2", func() (int, error) {
+		return 0, fmt.Errorf("t2 failed")
+	})
+	h3, _ := SubmitContext(&a, "t3", func(ctx context.Context) ([]int, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, WithTimeout(20*time.Millisecond))
+	if _, err = Submit(&a, "t1", func() (string, error) { return "", nil }); err == nil {
+		t.Fatal("duplicate task name")
+	}
+	if _, err = h1.Result(); err == nil {
+		t.Fatal("result before run")
+	}
+	a.Run(3)
+	a.Wait()
+	if v, err := h1.Result(); v != "t1" || err != nil || h1.Status() != STATUS_DONE {
+		t.Fatalf("t1: %v,%v", v, err)
+	}
+	if v, err := h2.Result(); v != 0 || err == nil || h2.Status() != STATUS_FAIL {
+		t.Fatalf("t2: %v,%v", v, err)
+	}
+	if v, err := h3.Result(); v != nil || err != context.DeadlineExceeded {
+		t.Fatalf("t3: %v,%v", v, err)
+	}
+	if _, err := GetResult[int](&a, "t1"); err == nil {
+		t.Fatal("t1 result type is string")
+	}
+}
+
+func TestSubmitAR(t *testing.T) {
+	a := NewAR(2)
+	var sum int32
+	for i := 0; i < 10; i++ {
+		i := i
+		SubmitAR(a, "", func() (int32, error) {
+			return int32(i), nil
+		}, func(v int32, err error) {
+			atomic.AddInt32(&sum, v)
+		})
+	}
+	a.Wait()
+	if sum != 45 {
+		t.Fatalf("sum: %d", sum)
+	}
+}
+
+func TestSubmitMiddleware(t *testing.T) {
+	a := New(false)
+	// 中间件替换了返回值时，Result返回错误而不是panic
+	a.Use(func(next Invoker) Invoker {
+		return func(ctx context.Context, inv *Invocation) ([]reflect.Value, error) {
+			if _, err := next(ctx, inv); err != nil {
+				return nil, err
+			}
+			return []reflect.Value{reflect.ValueOf("changed"), reflect.Zero(errorType)}, nil
+		}
+	})
+	h, _ := Submit(&a, "t1", func() (int, error) {
+		return 1, nil
+	})
+	a.Run(1)
+	a.Wait()
+	if v, err := h.Result(); v != 0 || err == nil {
+		t.Fatalf("t1: %v,%v", v, err)
+	}
+}
@@ -0,0 +1,185 @@
+package jasync
+
+// 钩子函数的类型
+const (
+	hookQueued = iota
+	hookStart
+	hookFinish
+)
+
+// 任务状态变化时调用的钩子函数，注册时复制一份，调用时无需加锁
+type hooks struct {
+	onQueued []func(TaskResult)
+	onStart  []func(TaskResult)
+	onFinish []func(TaskResult)
+	onError  []func(TaskResult)
+}
+
+// 返回添加了fn的副本，onError的kind为-1
+func (h *hooks) with(kind int, fn func(TaskResult)) *hooks {
+	n := &hooks{}
+	if h != nil {
+		*n = *h
+	}
+	switch kind {
+	case hookQueued:
+		n.onQueued = append(n.onQueued[:len(n.onQueued):len(n.onQueued)], fn)
+	case hookStart:
+		n.onStart = append(n.onStart[:len(n.onStart):len(n.onStart)], fn)
+	case hookFinish:
+		n.onFinish = append(n.onFinish[:len(n.onFinish):len(n.onFinish)], fn)
+	default:
+		n.onError = append(n.onError[:len(n.onError):len(n.onError)], fn)
+	}
+	return n
+}
+
+// 调用钩子函数，任务失败或超时时先调用onError再调用onFinish；钩子函数发生panic时只输出错误信息
+func (h *hooks) call(kind int, r TaskResult) {
+	if h == nil {
+		return
+	}
+	var fns []func(TaskResult)
+	switch kind {
+	case hookQueued:
+		fns = h.onQueued
+	case hookStart:
+		fns = h.onStart
+	case hookFinish:
+		if isFailed(r.Status) {
+			for _, fn := range h.onError {
+				callHook(fn, r)
+			}
+		}
+		fns = h.onFinish
+	}
+	for _, fn := range fns {
+		callHook(fn, r)
+	}
+}
+
+func callHook(fn func(TaskResult), r TaskResult) {
+	defer func() {
+		if p := recover(); p != nil {
+			jasyncLog.Errorf("%s 钩子函数 %v\n", r.Name, newPanicError(p))
+		}
+	}()
+	fn(r)
+}
+
+// 等待调用的钩子函数
+type hookEvent struct {
+	kind   int
+	hooks  *hooks
+	result TaskResult
+}
+
+// OnQueued 注册任务进入STATUS_QUEUE时调用的钩子函数
+//
+// 钩子函数在内部锁之外按事件发生的顺序依次调用，Wait返回前所有的钩子函数都已调用完成
+func (a *Async) OnQueued(fn func(TaskResult)) {
+	a.addHook(hookQueued, fn)
+}
+
+// OnStart 注册任务进入STATUS_DOING时调用的钩子函数
+func (a *Async) OnStart(fn func(TaskResult)) {
+	a.addHook(hookStart, fn)
+}
+
+// OnFinish 注册任务结束时调用的钩子函数，包括执行成功、失败、超时、被取消或跳过，TaskResult中为任务的结果
+func (a *Async) OnFinish(fn func(TaskResult)) {
+	a.addHook(hookFinish, fn)
+}
+
+// OnError 注册任务执行失败(STATUS_FAIL、STATUS_TIMEOUT)时调用的钩子函数，在OnFinish之前调用
+func (a *Async) OnError(fn func(TaskResult)) {
+	a.addHook(-1, fn)
+}
+
+func (a *Async) addHook(kind int, fn func(TaskResult)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hooks = a.hooks.with(kind, fn)
+}
+
+// 记录任务的状态变化，需持有写锁
+func (a *Async) emitHook(kind int, task *asyncTask, values []interface{}) {
+	if a.hooks == nil {
+		return
+	}
+	a.hookEvents = append(a.hookEvents, hookEvent{kind: kind, hooks: a.hooks, result: task.result(values)})
+}
+
+// 在锁之外调用已记录的钩子函数，其他协程正在调用时由其负责调用
+func (a *Async) fireHooks() {
+	for a.hookMu.TryLock() {
+		a.drainHooks()
+		a.hookMu.Unlock()
+		// 释放hookMu之前其他协程可能记录了新的事件
+		a.mu.RLock()
+		n := len(a.hookEvents)
+		a.mu.RUnlock()
+		if n == 0 {
+			return
+		}
+	}
+}
+
+// 等待正在调用的钩子函数结束，并调用已记录的钩子函数
+func (a *Async) flushHooks() {
+	a.hookMu.Lock()
+	defer a.hookMu.Unlock()
+	a.drainHooks()
+}
+
+// 调用已记录的钩子函数，需持有hookMu
+func (a *Async) drainHooks() {
+	for {
+		a.mu.Lock()
+		events := a.hookEvents
+		a.hookEvents = nil
+		a.mu.Unlock()
+		if len(events) == 0 {
+			return
+		}
+		for _, e := range events {
+			e.hooks.call(e.kind, e.result)
+		}
+	}
+}
+
+// OnQueued 注册任务等待获取并发数时调用的钩子函数
+//
+// AsyncRealtime的钩子函数在AddAndRun、CDO或任务所在的协程中同步调用，Wait返回前所有的钩子函数都已调用完成
+func (ar *AsyncRealtime) OnQueued(fn func(TaskResult)) {
+	ar.addHook(hookQueued, fn)
+}
+
+// OnStart 注册任务开始执行时调用的钩子函数
+func (ar *AsyncRealtime) OnStart(fn func(TaskResult)) {
+	ar.addHook(hookStart, fn)
+}
+
+// OnFinish 注册任务结束时调用的钩子函数，包括执行成功、失败、超时、被取消，TaskResult中为任务的结果
+func (ar *AsyncRealtime) OnFinish(fn func(TaskResult)) {
+	ar.addHook(hookFinish, fn)
+}
+
+// OnError 注册任务执行失败(STATUS_FAIL、STATUS_TIMEOUT)时调用的钩子函数，在OnFinish之前调用
+func (ar *AsyncRealtime) OnError(fn func(TaskResult)) {
+	ar.addHook(-1, fn)
+}
+
+func (ar *AsyncRealtime) addHook(kind int, fn func(TaskResult)) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	ar.hooks = ar.hooks.with(kind, fn)
+}
+
+// 调用钩子函数
+func (ar *AsyncRealtime) callHooks(kind int, r TaskResult) {
+	ar.mu.RLock()
+	h := ar.hooks
+	ar.mu.RUnlock()
+	h.call(kind, r)
+}
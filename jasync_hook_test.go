@@ -0,0 +1,90 @@
+package jasync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 按任务记录钩子函数的调用顺序
+type hookRecorder struct {
+	mu     sync.Mutex
+	events map[string][]string
+}
+
+func newHookRecorder() *hookRecorder {
+	return &hookRecorder{events: make(map[string][]string)}
+}
+
+func (h *hookRecorder) record(kind string) func(TaskResult) {
+	return func(r TaskResult) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		e := fmt.Sprintf("%s:%d", kind, r.Status)
+		if kind == "finish" && r.Values != nil {
+			e += fmt.Sprint("=", r.Values[0])
+		}
+		h.events[r.Name] = append(h.events[r.Name], e)
+	}
+}
+
+func (h *hookRecorder) String() string {
+	names := make([]string, 0)
+	for name := range h.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]string, 0)
+	for _, name := range names {
+		out = append(out, name+"="+strings.Join(h.events[name], ","))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestAsync_Hooks(t *testing.T) {
+	a := New(false)
+	h := newHookRecorder()
+	a.OnQueued(h.record("queued"))
+	a.OnStart(h.record("start"))
+	a.OnFinish(h.record("finish"))
+	a.OnError(h.record("error"))
+	// 钩子函数中可以调用Async的方法，panic不影响任务
+	a.OnFinish(func(r TaskResult) {
+		a.GetTaskStatus(r.Name)
+		panic("hook panic")
+	})
+	a.AddR("t1", func() int { return 1 }, nil)
+	a.AddR("t2", func() (int, error) { return 0, fmt.Errorf("t2 failed") }, nil)
+	a.Add("t3", func() {}, nil, After("t2"))
+	f, _ := a.AddFuture("t4", func() {}, nil)
+	f.Cancel()
+	a.Run(1)
+	a.Wait()
+	want := "t1=queued:1,start:2,finish:3=1 t2=queued:1,start:2,error:6,finish:6=0 t3=queued:1,finish:7 t4=finish:4"
+	if h.String() != want {
+		t.Fatalf("hooks:\n%s\n%s", h, want)
+	}
+}
+
+func TestAsync_ARHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ar := NewARContext(ctx, 1, false)
+	h := newHookRecorder()
+	ar.OnQueued(h.record("queued"))
+	ar.OnStart(h.record("start"))
+	ar.OnFinish(h.record("finish"))
+	ar.OnError(h.record("error"))
+	ar.AddAndRun("t1", func() int { return 1 }, nil)
+	ar.Init("t2").CAdd(func() (int, error) { return 0, fmt.Errorf("t2 failed") }).CDO()
+	ar.Wait()
+	cancel()
+	ar.AddAndRun("t3", func() {}, nil)
+	ar.Wait()
+	want := "t1=queued:1,start:2,finish:3=1 t2=queued:1,start:2,error:6,finish:6=0 t3=queued:1,finish:4"
+	if h.String() != want {
+		t.Fatalf("hooks:\n%s\n%s", h, want)
+	}
+}
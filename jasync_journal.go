@@ -0,0 +1,388 @@
+package jasync
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// 通过注册表添加的任务
+type namedTask struct {
+	handler string            // 注册表中的任务函数名
+	args    []json.RawMessage // 序列化后的参数
+}
+
+func newNamedTask(handler string, args []interface{}) (*namedTask, error) {
+	named := &namedTask{
+		handler: handler,
+		args:    make([]json.RawMessage, len(args)),
+	}
+	for k, v := range args {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个参数无法序列化: %v", k, err)
+		}
+		named.args[k] = b
+	}
+	return named, nil
+}
+
+// 日志中的一条记录
+type journalRecord struct {
+	Op      string            `json:"op"` // add: 添加任务，status: 任务状态变化
+	Task    string            `json:"task"`
+	Time    int64             `json:"time"` // 纳秒时间戳
+	Handler string            `json:"handler,omitempty"`
+	Args    []json.RawMessage `json:"args,omitempty"`
+	Opt     *journalOption    `json:"opt,omitempty"`
+	Status  int               `json:"status"`
+	Err     string            `json:"err,omitempty"`
+	Result  []json.RawMessage `json:"result,omitempty"`
+}
+
+// 日志中可以保存的任务选项
+//
+// RetryPolicy.Retryable无法序列化，不会被保存，恢复的任务按默认规则判断是否重试
+type journalOption struct {
+	Timeout   time.Duration `json:"timeout,omitempty"`
+	Priority  int           `json:"priority,omitempty"`
+	Key       string        `json:"key,omitempty"`
+	After     []string      `json:"after,omitempty"`
+	Inject    bool          `json:"inject,omitempty"`
+	Retry     *journalRetry `json:"retry,omitempty"`
+	Group     string        `json:"group,omitempty"`
+	Weight    int64         `json:"weight,omitempty"`
+	Resources Resources     `json:"resources,omitempty"`
+}
+
+// 日志中保存的重试策略
+type journalRetry struct {
+	MaxAttempts int           `json:"max_attempts,omitempty"`
+	BaseDelay   time.Duration `json:"base_delay,omitempty"`
+	MaxDelay    time.Duration `json:"max_delay,omitempty"`
+	Jitter      float64       `json:"jitter,omitempty"`
+}
+
+func newJournalOption(o *taskOption) *journalOption {
+	jo := &journalOption{
+		Timeout:   o.timeout,
+		Priority:  o.priority,
+		Key:       o.key,
+		After:     o.after,
+		Inject:    o.inject,
+		Group:     o.group,
+		Weight:    o.weight,
+		Resources: o.demand,
+	}
+	if o.retry != nil {
+		jo.Retry = &journalRetry{
+			MaxAttempts: o.retry.MaxAttempts,
+			BaseDelay:   o.retry.BaseDelay,
+			MaxDelay:    o.retry.MaxDelay,
+			Jitter:      o.retry.Jitter,
+		}
+	}
+	if jo.Timeout == 0 && jo.Priority == 0 && jo.Key == "" && len(jo.After) == 0 &&
+		jo.Retry == nil && jo.Group == "" && jo.Weight == 0 && len(jo.Resources) == 0 {
+		return nil
+	}
+	return jo
+}
+
+func (jo *journalOption) options() []interface{} {
+	if jo == nil {
+		return nil
+	}
+	opts := []interface{}{WithTimeout(jo.Timeout), WithPriority(jo.Priority), WithKey(jo.Key), WithGroup(jo.Group), WithWeight(jo.Weight)}
+	if jo.Inject {
+		opts = append(opts, AfterWithResults(jo.After...))
+	} else {
+		opts = append(opts, After(jo.After...))
+	}
+	if jo.Retry != nil {
+		opts = append(opts, WithRetry(RetryPolicy{
+			MaxAttempts: jo.Retry.MaxAttempts,
+			BaseDelay:   jo.Retry.BaseDelay,
+			MaxDelay:    jo.Retry.MaxDelay,
+			Jitter:      jo.Retry.Jitter,
+		}))
+	}
+	if len(jo.Resources) > 0 {
+		opts = append(opts, WithResources(jo.Resources))
+	}
+	return opts
+}
+
+// 追加写入的任务日志，每行一条json记录
+type journal struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func (j *journal) write(r *journalRecord) {
+	r.Time = time.Now().UnixNano()
+	if err := j.enc.Encode(r); err != nil {
+		jasyncLog.Errorf("写入日志失败: %v\n", err)
+	}
+}
+
+// SetJournal 设置任务日志文件，追加写入通过AddNamed添加的任务及其状态变化、执行结果
+//
+// 已添加的任务会被立即写入；可通过ResumeFrom从日志中恢复任务
+func (a *Async) SetJournal(path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.openJournal(path); err != nil {
+		return err
+	}
+	for _, v := range a.order {
+		a.journalAdd(v)
+		if v.TaskStatus.taskStatus != STATUS_INIT {
+			a.journalStatus(v, a.tasksResult[v.name])
+		}
+	}
+	return nil
+}
+
+// 打开日志文件，需持有写锁
+func (a *Async) openJournal(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if a.journal != nil {
+		a.journal.f.Close()
+	}
+	a.journal = &journal{f: f, enc: json.NewEncoder(f)}
+	return nil
+}
+
+// CloseJournal 关闭任务日志文件
+func (a *Async) CloseJournal() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.journal == nil {
+		return nil
+	}
+	err := a.journal.f.Close()
+	a.journal = nil
+	return err
+}
+
+// 记录任务的添加，需持有写锁
+func (a *Async) journalAdd(task *asyncTask) {
+	if a.journal == nil || task.named == nil {
+		return
+	}
+	a.journal.write(&journalRecord{
+		Op:      "add",
+		Task:    task.name,
+		Handler: task.named.handler,
+		Args:    task.named.args,
+		Opt:     newJournalOption(task.opt),
+	})
+}
+
+// 记录任务的状态变化及执行结果，需持有写锁
+func (a *Async) journalStatus(task *asyncTask, result []interface{}) {
+	if a.journal == nil || task.named == nil {
+		return
+	}
+	r := &journalRecord{
+		Op:     "status",
+		Task:   task.name,
+		Status: task.TaskStatus.taskStatus,
+	}
+	if task.TaskStatus.taskErr != nil {
+		r.Err = task.TaskStatus.taskErr.Error()
+	}
+	if r.Status == STATUS_DONE && result != nil {
+		values, err := encodeValues(result)
+		if err != nil {
+			jasyncLog.Errorf("%s 的执行结果无法序列化: %v\n", task.name, err)
+		}
+		r.Result = values
+	}
+	a.journal.write(r)
+}
+
+// 序列化任务的返回值，error类型的返回值保存为其错误信息
+func encodeValues(values []interface{}) ([]json.RawMessage, error) {
+	raw := make([]json.RawMessage, len(values))
+	for k, v := range values {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		raw[k] = b
+	}
+	return raw, nil
+}
+
+// 按任务函数的返回值类型反序列化执行结果
+func decodeValues(t reflect.Type, raw []json.RawMessage) ([]interface{}, error) {
+	if len(raw) != t.NumOut() {
+		return nil, fmt.Errorf("返回值个数不同")
+	}
+	values := make([]interface{}, len(raw))
+	for k, b := range raw {
+		out := t.Out(k)
+		if out == errorType {
+			var msg *string
+			if err := json.Unmarshal(b, &msg); err != nil {
+				return nil, err
+			}
+			if msg != nil {
+				values[k] = errors.New(*msg)
+			}
+			continue
+		}
+		v := reflect.New(out)
+		if err := json.Unmarshal(b, v.Interface()); err != nil {
+			return nil, err
+		}
+		values[k] = v.Elem().Interface()
+	}
+	return values, nil
+}
+
+// ResumeFrom 从任务日志中恢复任务，并继续向该日志追加写入
+//
+// 状态为STATUS_DONE的任务恢复其执行结果，不再执行；其他任务及执行结果无法解码的任务恢复为STATUS_INIT，在下次Run时执行。
+// 任务函数通过注册表中的名称查找，日志文件不存在时只设置日志文件。
+// 任务选项随任务一起恢复，但RetryPolicy.Retryable无法保存，恢复后为nil
+func (a *Async) ResumeFrom(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return a.SetJournal(path)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	type entry struct {
+		add    *journalRecord
+		last   *journalRecord
+		begin  int64
+		result []json.RawMessage
+	}
+	entries := make(map[string]*entry)
+	names := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	badLine := 0
+	// 最后一条完整记录的结尾位置
+	var offset, size int64
+	for scanner.Scan() {
+		line++
+		size += int64(len(scanner.Bytes())) + 1
+		r := &journalRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			// 进程退出时最后一行可能没有写完整
+			badLine = line
+			continue
+		}
+		offset = size
+		if badLine != 0 {
+			return fmt.Errorf("日志第%d行格式错误", badLine)
+		}
+		e := entries[r.Task]
+		if r.Op == "add" {
+			if e == nil {
+				e = &entry{}
+				entries[r.Task] = e
+				names = append(names, r.Task)
+			}
+			e.add = r
+			continue
+		}
+		if e == nil {
+			continue
+		}
+		e.last = r
+		if r.Status == STATUS_DOING {
+			e.begin = r.Time
+		}
+		if r.Result != nil {
+			e.result = r.Result
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	registry := a.getRegistry()
+	tasks := make([]*asyncTask, 0, len(names))
+	results := make(map[string][]interface{})
+	for _, name := range names {
+		e := entries[name]
+		sig, err := registry.lookup(e.add.Handler)
+		if err != nil {
+			return fmt.Errorf("恢复任务 %s 失败: %v", name, err)
+		}
+		args, err := sig.decodeArgs(e.add.Args)
+		if err != nil {
+			return fmt.Errorf("恢复任务 %s 失败: %v", name, err)
+		}
+		task, err := a.newTask(name, sig.value.Interface(), nil, true, append(args, e.add.Opt.options()...)...)
+		if err != nil {
+			return fmt.Errorf("恢复任务 %s 失败: %v", name, err)
+		}
+		task.named = &namedTask{handler: e.add.Handler, args: e.add.Args}
+		task.withCtx = sig.withCtx
+		handlerValue := sig.value
+		if e.last != nil && e.last.Status == STATUS_DONE {
+			var result []interface{}
+			if e.result != nil {
+				// 执行结果无法解码时(如返回值为带方法的接口)，任务恢复为STATUS_INIT重新执行
+				if result, err = decodeValues(handlerValue.Type(), e.result); err != nil {
+					jasyncLog.Errorf("恢复任务 %s 的执行结果失败，将重新执行: %v\n", name, err)
+					tasks = append(tasks, task)
+					continue
+				}
+				results[name] = result
+			}
+			task.TaskStatus.taskStatus = STATUS_DONE
+			task.TaskStatus.taskBegTime = e.begin
+			task.TaskStatus.taskEndTime = e.last.Time
+			task.future.finish(STATUS_DONE, result, nil)
+		}
+		tasks = append(tasks, task)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, task := range tasks {
+		if _, ok := a.tasks[task.name]; ok {
+			return fmt.Errorf(task.name + " 任务已存在!")
+		}
+	}
+	// 截掉没有写完整的最后一行，避免与后续追加的记录连在一起
+	if badLine != 0 {
+		if err := os.Truncate(path, offset); err != nil {
+			return err
+		}
+	}
+	for _, task := range tasks {
+		a.tasks[task.name] = task
+		a.order = append(a.order, task)
+		a.taskAllTotal++
+		a.taskCurAllTotal++
+		if task.TaskStatus.taskStatus == STATUS_DONE {
+			if result, ok := results[task.name]; ok {
+				a.tasksResult[task.name] = result
+			}
+			continue
+		}
+		a.taskNeedDoCount++
+		a.taskCurNeedDoCount++
+		a.metrics.submit(task.opt.group)
+	}
+	return a.openJournal(path)
+}
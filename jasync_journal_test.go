@@ -0,0 +1,139 @@
+package jasync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAsync_ResumeFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	calls := make(map[int]int)
+	registry := NewRegistry()
+	if err := registry.Register("square", func(n int) (int, error) {
+		calls[n]++
+		// 第一次执行3时失败
+		if n == 3 && calls[n] == 1 {
+			return 0, fmt.Errorf("%d failed", n)
+		}
+		return n * n, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("square", func() {}); err == nil {
+		t.Fatal("duplicate register")
+	}
+
+	a := New(false)
+	a.SetRegistry(registry)
+	if err := a.ResumeFrom(path); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		if _, ok, err := a.AddNamed(fmt.Sprintf("t%d", i), "square", i, WithPriority(i)); !ok {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, _ := a.AddNamed("t5", "cube", 5); ok {
+		t.Fatal("unregistered handler")
+	}
+	a.Run(1)
+	a.Wait()
+	a.CloseJournal()
+	if a.GetTaskStatus("t3") != STATUS_FAIL {
+		t.Fatalf("t3: %d", a.GetTaskStatus("t3"))
+	}
+	// 模拟进程退出时最后一行没有写完整
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"op":"status","ta`)
+	f.Close()
+
+	b := New(false)
+	b.SetRegistry(registry)
+	if err := b.ResumeFrom(path); err != nil {
+		t.Fatal(err)
+	}
+	if b.GetTaskNeedDoCount() != 1 || b.GetTaskStatus("t3") != STATUS_INIT || b.GetTaskStatus("t2") != STATUS_DONE {
+		t.Fatalf("need do: %d", b.GetTaskNeedDoCount())
+	}
+	if r := b.GetTaskResult("t2"); len(r) != 2 || r[0] != 4 || r[1] != nil {
+		t.Fatalf("t2 result: %v", r)
+	}
+	b.Run(1)
+	b.Wait()
+	b.CloseJournal()
+	if r := b.GetTaskResult("t3"); len(r) != 2 || r[0] != 9 || calls[3] != 2 || calls[1] != 1 {
+		t.Fatalf("t3 result: %v, calls: %v", r, calls)
+	}
+	// 再次恢复时所有任务都已完成
+	c := New(false)
+	c.SetRegistry(registry)
+	if err := c.ResumeFrom(path); err != nil {
+		t.Fatal(err)
+	}
+	c.CloseJournal()
+	if c.GetTaskNeedDoCount() != 0 || c.GetTaskResult("t3")[0] != 9 {
+		t.Fatalf("need do: %d", c.GetTaskNeedDoCount())
+	}
+}
+
+func TestAsync_ResumeFromOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	registry := NewRegistry()
+	registry.Register("noop", func() {})
+	a := New(false)
+	a.SetRegistry(registry)
+	a.SetJournal(path)
+	retry := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Jitter: 0.5}
+	a.AddNamed("t1", "noop", WithRetry(retry), WithGroup("g"), WithWeight(2), WithResources(Resources{"cpu": 2}))
+	a.CloseJournal()
+
+	b := New(false)
+	b.SetRegistry(registry)
+	if err := b.ResumeFrom(path); err != nil {
+		t.Fatal(err)
+	}
+	b.CloseJournal()
+	opt := b.tasks["t1"].opt
+	if r := opt.retry; r == nil || r.MaxAttempts != 3 || r.BaseDelay != time.Second || r.MaxDelay != time.Minute || r.Jitter != 0.5 {
+		t.Fatalf("retry: %+v", opt.retry)
+	}
+	if opt.group != "g" || opt.weight != 2 || opt.demand["cpu"] != 2 {
+		t.Fatalf("opt: %+v", opt)
+	}
+}
+
+func TestAsync_ResumeFromUndecodable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	registry := NewRegistry()
+	calls := 0
+	registry.Register("stringer", func(n int) fmt.Stringer {
+		calls++
+		return time.Duration(n)
+	})
+	a := New(false)
+	a.SetRegistry(registry)
+	a.SetJournal(path)
+	a.AddNamed("t1", "stringer", 1)
+	a.Run(1)
+	a.Wait()
+	a.CloseJournal()
+
+	// 返回值为带方法的接口，执行结果无法解码时重新执行该任务
+	b := New(false)
+	b.SetRegistry(registry)
+	if err := b.ResumeFrom(path); err != nil {
+		t.Fatal(err)
+	}
+	if b.GetTaskNeedDoCount() != 1 || b.GetTaskStatus("t1") != STATUS_INIT {
+		t.Fatalf("t1: %d", b.GetTaskStatus("t1"))
+	}
+	b.Run(1)
+	b.Wait()
+	b.CloseJournal()
+	if r := b.GetTaskResult("t1"); len(r) != 1 || r[0] != time.Duration(1) || calls != 2 {
+		t.Fatalf("t1 result: %v, calls: %d", r, calls)
+	}
+}
@@ -0,0 +1,207 @@
+package jasync
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// KeyLimit 同一key的任务的限制
+type KeyLimit struct {
+	Concurrency int     // 最大并发数，<=0表示不限制
+	Rate        float64 // 每秒最多开始的任务数，<=0表示不限速
+	Burst       int     // 允许突发的任务数
+}
+
+// KeyStats 同一key的任务的统计信息
+type KeyStats struct {
+	Limit    KeyLimit
+	Running  int   // 正在执行的任务数
+	Waiting  int   // 等待执行的任务数
+	Started  int64 // 已开始执行的次数，重试时每次尝试都计算在内
+	Finished int64 // 已结束执行的次数
+}
+
+// WithKey 设置任务的分组key，如目标主机
+//
+// 同一key的任务受SetKeyLimit设置的并发数与速率限制，同时仍受全局的并发数限制
+func WithKey(key string) TaskOption {
+	return func(o *taskOption) {
+		o.key = key
+	}
+}
+
+// 按key限制任务的并发数与速率
+type keyLimiter struct {
+	mu      sync.Mutex
+	def     KeyLimit            // 未单独设置的key使用的限制
+	limits  map[string]KeyLimit // 单独设置的限制
+	keys    map[string]*keyState
+	changed chan struct{} // 有任务结束或限制变化时关闭，唤醒等待中的协程
+}
+
+type keyState struct {
+	limit    KeyLimit
+	limiter  *RateLimiter
+	running  int
+	waiting  int
+	started  int64
+	finished int64
+}
+
+func newKeyLimiter() *keyLimiter {
+	return &keyLimiter{
+		limits:  make(map[string]KeyLimit),
+		keys:    make(map[string]*keyState),
+		changed: make(chan struct{}),
+	}
+}
+
+// 设置key的限制，key为空时设置所有未单独设置的key的默认限制
+func (k *keyLimiter) setLimit(key string, limit KeyLimit) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key == "" {
+		k.def = limit
+	} else {
+		k.limits[key] = limit
+	}
+	for name, state := range k.keys {
+		if name == key || key == "" {
+			state.setLimit(k.limitOf(name))
+		}
+	}
+	k.notify()
+}
+
+// 获取key的限制
+func (k *keyLimiter) limit(key string) KeyLimit {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.limitOf(key)
+}
+
+// key的限制，需持有锁
+func (k *keyLimiter) limitOf(key string) KeyLimit {
+	if limit, ok := k.limits[key]; ok {
+		return limit
+	}
+	return k.def
+}
+
+// key的状态，不存在时创建，需持有锁
+func (k *keyLimiter) state(key string) *keyState {
+	state := k.keys[key]
+	if state == nil {
+		state = &keyState{limiter: NewRateLimiter(0, 0)}
+		state.setLimit(k.limitOf(key))
+		k.keys[key] = state
+	}
+	return state
+}
+
+func (s *keyState) setLimit(limit KeyLimit) {
+	s.limit = limit
+	s.limiter.SetLimit(limit.Rate, limit.Burst)
+}
+
+// 检查key是否可以开始一个任务，take为true时占用一个并发数并消耗一个令牌
+//
+// 不能开始时返回需要等待的时间，为0表示需要等待有任务结束
+func (k *keyLimiter) reserve(key string, take bool) (bool, time.Duration) {
+	if key == "" {
+		return true, 0
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	state := k.state(key)
+	if state.limit.Concurrency > 0 && state.running >= state.limit.Concurrency {
+		return false, 0
+	}
+	if ok, d := state.limiter.reserve(take); !ok {
+		return false, d
+	}
+	if take {
+		state.running++
+		state.started++
+	}
+	return true, 0
+}
+
+// 占用key的一个并发数并等待限速，ctx被取消时返回ctx.Err()
+func (k *keyLimiter) acquire(ctx context.Context, key string) error {
+	if key == "" {
+		return nil
+	}
+	k.mu.Lock()
+	k.state(key).waiting++
+	k.mu.Unlock()
+	defer func() {
+		k.mu.Lock()
+		k.state(key).waiting--
+		k.mu.Unlock()
+	}()
+	for {
+		// 先获取changed，避免错过检查之后的任务结束
+		k.mu.Lock()
+		changed := k.changed
+		k.mu.Unlock()
+		ok, d := k.reserve(key, true)
+		if ok {
+			return nil
+		}
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if d > 0 {
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// 释放key的一个并发数
+func (k *keyLimiter) release(key string) {
+	if key == "" {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	state := k.state(key)
+	state.running--
+	state.finished++
+	k.notify()
+}
+
+// 唤醒等待中的协程，需持有锁
+func (k *keyLimiter) notify() {
+	close(k.changed)
+	k.changed = make(chan struct{})
+}
+
+// 获取所有key的统计信息
+func (k *keyLimiter) stats() map[string]KeyStats {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	stats := make(map[string]KeyStats, len(k.keys))
+	for name, state := range k.keys {
+		stats[name] = KeyStats{
+			Limit:    state.limit,
+			Running:  state.running,
+			Waiting:  state.waiting,
+			Started:  state.started,
+			Finished: state.finished,
+		}
+	}
+	return stats
+}
@@ -0,0 +1,89 @@
+package jasync
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录同时执行的任务数的最大值
+type runningCounter struct {
+	mu      sync.Mutex
+	running map[string]int
+	max     map[string]int
+}
+
+func newRunningCounter() *runningCounter {
+	return &runningCounter{running: make(map[string]int), max: make(map[string]int)}
+}
+
+func (c *runningCounter) run(key string, d time.Duration) {
+	c.mu.Lock()
+	c.running[key]++
+	if c.running[key] > c.max[key] {
+		c.max[key] = c.running[key]
+	}
+	c.mu.Unlock()
+	time.Sleep(d)
+	c.mu.Lock()
+	c.running[key]--
+	c.mu.Unlock()
+}
+
+func TestAsync_WithKey(t *testing.T) {
+	a := New(false)
+	a.SetKeyLimit("", KeyLimit{Concurrency: 1})
+	a.SetKeyLimit("h2", KeyLimit{Concurrency: 2})
+	c := newRunningCounter()
+	for i := 0; i < 4; i++ {
+		a.Add("", func() { c.run("h1", 30*time.Millisecond) }, nil, WithKey("h1"))
+	}
+	h2 := make([]string, 0)
+	for i := 0; i < 4; i++ {
+		name, _, _ := a.AddR("", func() int64 {
+			c.run("h2", 10*time.Millisecond)
+			return time.Now().UnixNano()
+		}, nil, WithKey("h2"))
+		h2 = append(h2, name)
+	}
+	start := time.Now()
+	a.Run(3)
+	a.Wait()
+	if c.max["h1"] != 1 || c.max["h2"] != 2 {
+		t.Fatalf("max: %v", c.max)
+	}
+	// h1达到限制时不阻塞h2的任务
+	for _, name := range h2 {
+		if d := time.Unix(0, a.GetTaskResult(name)[0].(int64)).Sub(start); d > 60*time.Millisecond {
+			t.Fatalf("%s: %v", name, d)
+		}
+	}
+	if st := a.KeyStats()["h2"]; st.Limit.Concurrency != 2 {
+		t.Fatalf("stats: %+v", st)
+	}
+	if st := a.KeyStats()["h1"]; st.Running != 0 || st.Started != 4 || st.Finished != 4 {
+		t.Fatalf("stats: %+v", st)
+	}
+}
+
+func TestAsync_ARWithKey(t *testing.T) {
+	ar := NewAR(4, false)
+	ar.SetKeyLimit("h1", KeyLimit{Concurrency: 1, Rate: 100, Burst: 1})
+	c := newRunningCounter()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		ar.AddAndRun("", func() { c.run("h1", 10*time.Millisecond) }, nil, WithKey("h1"))
+		ar.Init("").CAdd(func() { c.run("h1", 10*time.Millisecond) }).COpt(WithKey("h1")).CDO()
+		ar.AddAndRun("", func() { c.run("h2", 10*time.Millisecond) }, nil, WithKey("h2"))
+	}
+	ar.Wait()
+	if c.max["h1"] != 1 || c.max["h2"] < 1 {
+		t.Fatalf("max: %v", c.max)
+	}
+	if d := time.Since(start); d < 60*time.Millisecond {
+		t.Fatalf("elapsed: %v", d)
+	}
+	if st := ar.KeyStats()["h1"]; st.Started != 6 || st.Finished != 6 || st.Running != 0 {
+		t.Fatalf("stats: %+v", st)
+	}
+}
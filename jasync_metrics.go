@@ -0,0 +1,240 @@
+package jasync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets 直方图默认的桶，单位为秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// WithGroup 设置任务所属的分组，作为Metrics中的group标签，默认为default
+func WithGroup(group string) TaskOption {
+	return func(o *taskOption) {
+		o.group = group
+	}
+}
+
+// Metrics 调度器的指标，按任务分组统计，可同时用于多个Async、AsyncRealtime
+//
+// 实现了http.Handler，以OpenMetrics文本格式输出
+type Metrics struct {
+	mu      sync.Mutex
+	buckets []float64
+	groups  map[string]*groupMetrics
+}
+
+// 一个分组的指标
+type groupMetrics struct {
+	submitted int64
+	started   int64
+	completed int64 // STATUS_DONE
+	failed    int64 // STATUS_FAIL、STATUS_TIMEOUT
+	canceled  int64 // STATUS_CANCEL、STATUS_SKIP
+	inFlight  int64
+	queued    int64
+	wait      *histogram
+	duration  *histogram
+}
+
+type histogram struct {
+	counts []int64 // 与buckets一一对应，最后一个为+Inf
+	sum    float64
+	count  int64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	for k, b := range buckets {
+		if v <= b {
+			h.counts[k]++
+		}
+	}
+	h.counts[len(buckets)]++
+	h.sum += v
+	h.count++
+}
+
+// NewMetrics 创建调度器指标，buckets为直方图的桶，单位为秒，默认为DefaultBuckets
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		buckets: buckets,
+		groups:  make(map[string]*groupMetrics),
+	}
+}
+
+// 获取分组的指标，需持有锁
+func (m *Metrics) group(name string) *groupMetrics {
+	if name == "" {
+		name = "default"
+	}
+	g := m.groups[name]
+	if g == nil {
+		g = &groupMetrics{
+			wait:     &histogram{counts: make([]int64, len(m.buckets)+1)},
+			duration: &histogram{counts: make([]int64, len(m.buckets)+1)},
+		}
+		m.groups[name] = g
+	}
+	return g
+}
+
+// 以下方法在m为nil时不做任何操作
+
+// 任务被提交
+func (m *Metrics) submit(group string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.group(group).submitted++
+}
+
+// 任务进入或离开等待队列
+func (m *Metrics) queue(group string, delta int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.group(group).queued += delta
+}
+
+// 任务开始执行，wait为等待并发数的时间
+func (m *Metrics) start(group string, wait time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g := m.group(group)
+	g.started++
+	g.inFlight++
+	g.wait.observe(m.buckets, wait.Seconds())
+}
+
+// 已开始执行的任务结束
+func (m *Metrics) finish(group string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g := m.group(group)
+	g.inFlight--
+	g.duration.observe(m.buckets, d.Seconds())
+	g.count(status)
+}
+
+// 未开始执行的任务结束，如被取消或跳过
+func (m *Metrics) discard(group string, status int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.group(group).count(status)
+}
+
+func (g *groupMetrics) count(status int) {
+	switch status {
+	case STATUS_DONE:
+		g.completed++
+	case STATUS_FAIL, STATUS_TIMEOUT:
+		g.failed++
+	default:
+		g.canceled++
+	}
+}
+
+// ServeHTTP 以OpenMetrics文本格式输出指标
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo 以OpenMetrics文本格式输出指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.groups))
+	for name := range m.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	counter := func(name, help string, value func(g *groupMetrics) int64) {
+		fmt.Fprintf(cw, "# TYPE jasync_%s counter\n# HELP jasync_%s %s\n", name, name, help)
+		for _, group := range names {
+			fmt.Fprintf(cw, "jasync_%s_total{group=\"%s\"} %d\n", name, escapeLabel(group), value(m.groups[group]))
+		}
+	}
+	gauge := func(name, help string, value func(g *groupMetrics) int64) {
+		fmt.Fprintf(cw, "# TYPE jasync_%s gauge\n# HELP jasync_%s %s\n", name, name, help)
+		for _, group := range names {
+			fmt.Fprintf(cw, "jasync_%s{group=\"%s\"} %d\n", name, escapeLabel(group), value(m.groups[group]))
+		}
+	}
+	hist := func(name, help string, value func(g *groupMetrics) *histogram) {
+		fmt.Fprintf(cw, "# TYPE jasync_%s histogram\n# HELP jasync_%s %s\n", name, name, help)
+		for _, group := range names {
+			h := value(m.groups[group])
+			label := escapeLabel(group)
+			for k, b := range m.buckets {
+				fmt.Fprintf(cw, "jasync_%s_bucket{group=\"%s\",le=\"%s\"} %d\n", name, label, strconv.FormatFloat(b, 'g', -1, 64), h.counts[k])
+			}
+			fmt.Fprintf(cw, "jasync_%s_bucket{group=\"%s\",le=\"+Inf\"} %d\n", name, label, h.counts[len(m.buckets)])
+			fmt.Fprintf(cw, "jasync_%s_sum{group=\"%s\"} %s\n", name, label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+			fmt.Fprintf(cw, "jasync_%s_count{group=\"%s\"} %d\n", name, label, h.count)
+		}
+	}
+	counter("tasks_submitted", "已提交的任务数", func(g *groupMetrics) int64 { return g.submitted })
+	counter("tasks_started", "已开始执行的任务数", func(g *groupMetrics) int64 { return g.started })
+	counter("tasks_completed", "执行成功的任务数", func(g *groupMetrics) int64 { return g.completed })
+	counter("tasks_failed", "执行失败或超时的任务数", func(g *groupMetrics) int64 { return g.failed })
+	counter("tasks_canceled", "被取消或跳过的任务数", func(g *groupMetrics) int64 { return g.canceled })
+	gauge("tasks_in_flight", "正在执行的任务数", func(g *groupMetrics) int64 { return g.inFlight })
+	gauge("tasks_queued", "等待执行的任务数", func(g *groupMetrics) int64 { return g.queued })
+	hist("semaphore_wait_seconds", "任务等待并发数的时间", func(g *groupMetrics) *histogram { return g.wait })
+	hist("task_duration_seconds", "任务的执行时间", func(g *groupMetrics) *histogram { return g.duration })
+	fmt.Fprint(cw, "# EOF\n")
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// 统计写入的字节数并记录第一个错误
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
@@ -0,0 +1,72 @@
+package jasync
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(0.01, 0.1)
+	a := New(false)
+	a.SetMetrics(m)
+	for i := 0; i < 3; i++ {
+		i := i
+		a.Add("", func() error {
+			time.Sleep(20 * time.Millisecond)
+			if i == 2 {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		}, nil, WithGroup(`sc"an`))
+	}
+	f, _ := a.AddFuture("", func() {}, nil)
+	f.Cancel()
+	a.Run(1)
+	a.Wait()
+
+	ar := NewAR(2, false)
+	ar.SetMetrics(m)
+	ar.AddAndRun("", func() {}, nil)
+	ar.Init("").CAdd(func() {}).COpt(WithGroup("chain")).CDO()
+	ar.Wait()
+
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	out := string(body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/openmetrics-text") {
+		t.Fatalf("content type: %s", resp.Header.Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"# TYPE jasync_tasks_submitted counter",
+		`jasync_tasks_submitted_total{group="sc\"an"} 3`,
+		`jasync_tasks_submitted_total{group="default"} 2`,
+		`jasync_tasks_started_total{group="sc\"an"} 3`,
+		`jasync_tasks_completed_total{group="sc\"an"} 2`,
+		`jasync_tasks_failed_total{group="sc\"an"} 1`,
+		`jasync_tasks_canceled_total{group="default"} 1`,
+		`jasync_tasks_completed_total{group="chain"} 1`,
+		`jasync_tasks_in_flight{group="sc\"an"} 0`,
+		`jasync_tasks_queued{group="default"} 0`,
+		`jasync_task_duration_seconds_bucket{group="sc\"an",le="0.01"} 0`,
+		`jasync_task_duration_seconds_bucket{group="sc\"an",le="0.1"} 3`,
+		`jasync_task_duration_seconds_count{group="sc\"an"} 3`,
+		`jasync_semaphore_wait_seconds_bucket{group="sc\"an",le="+Inf"} 3`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("missing %s in\n%s", line, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Fatal("missing EOF")
+	}
+}
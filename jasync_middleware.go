@@ -0,0 +1,71 @@
+package jasync
+
+import (
+	"context"
+	"reflect"
+)
+
+// Invocation 一次任务函数的调用
+type Invocation struct {
+	TaskName string
+	Step     int             // 任务链中函数的序号，从0开始，单个任务为0；为-1时表示整个任务链
+	Handler  reflect.Value   // 任务函数，整个任务链时无效
+	Args     []reflect.Value // 实参，包括注入的ctx；整个任务链时为第一个函数的实参
+}
+
+// Invoker 调用任务函数，返回任务函数的返回值；返回非nil的error时任务视为失败
+type Invoker func(ctx context.Context, inv *Invocation) ([]reflect.Value, error)
+
+// Middleware 包装Invoker的中间件，用于计时、追踪、注入参数等
+//
+// 中间件在超时与panic捕获之内执行，ctx为任务执行期间使用的ctx
+type Middleware func(next Invoker) Invoker
+
+// 直接调用任务函数
+func invokeHandler(ctx context.Context, inv *Invocation) ([]reflect.Value, error) {
+	return inv.Handler.Call(inv.Args), nil
+}
+
+// 按顺序组合中间件，先添加的中间件在最外层，last在最内层
+func chainMiddleware(mws []Middleware, last Invoker) Invoker {
+	invoke := last
+	for i := len(mws) - 1; i >= 0; i-- {
+		invoke = mws[i](invoke)
+	}
+	return invoke
+}
+
+// Use 添加包装每次任务函数调用的中间件，先添加的中间件在最外层
+func (a *Async) Use(mws ...Middleware) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.middlewares = append(a.middlewares[:len(a.middlewares):len(a.middlewares)], mws...)
+}
+
+// 获取包装了中间件的Invoker
+func (a *Async) invoker() Invoker {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return chainMiddleware(a.middlewares, invokeHandler)
+}
+
+// Use 添加包装每次任务函数调用的中间件，先添加的中间件在最外层
+//
+// 任务链中的每个函数与整个任务链(Invocation.Step为-1)都会被中间件包装
+func (ar *AsyncRealtime) Use(mws ...Middleware) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	ar.middlewares = append(ar.middlewares[:len(ar.middlewares):len(ar.middlewares)], mws...)
+}
+
+// 获取已添加的中间件
+func (ar *AsyncRealtime) getMiddlewares() []Middleware {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+	return ar.middlewares
+}
+
+// 获取包装了中间件的Invoker
+func (ar *AsyncRealtime) invoker() Invoker {
+	return chainMiddleware(ar.getMiddlewares(), invokeHandler)
+}
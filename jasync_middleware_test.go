@@ -0,0 +1,81 @@
+package jasync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 记录每次调用的中间件
+func traceMiddleware(mu *sync.Mutex, calls *[]string) Middleware {
+	return func(next Invoker) Invoker {
+		return func(ctx context.Context, inv *Invocation) ([]reflect.Value, error) {
+			mu.Lock()
+			*calls = append(*calls, fmt.Sprintf("%s:%d", inv.TaskName, inv.Step))
+			mu.Unlock()
+			return next(ctx, inv)
+		}
+	}
+}
+
+func TestAsync_Use(t *testing.T) {
+	var mu sync.Mutex
+	calls := make([]string, 0)
+	a := New(false)
+	a.Use(traceMiddleware(&mu, &calls), func(next Invoker) Invoker {
+		return func(ctx context.Context, inv *Invocation) ([]reflect.Value, error) {
+			switch inv.TaskName {
+			case "deny":
+				return nil, errors.New("denied")
+			case "auth":
+				// 注入实参
+				inv.Args = append(inv.Args, reflect.ValueOf("token"))
+			}
+			return next(ctx, inv)
+		}
+	})
+	a.AddR("auth", func(s string) string { return s }, nil)
+	a.AddR("deny", func() {}, nil)
+	a.AddR("panic", func() { panic("boom") }, nil)
+	a.Run(2)
+	a.Wait()
+	if r := a.GetTaskResult("auth"); r[0] != "token" {
+		t.Fatalf("auth result: %v", r)
+	}
+	if s := a.GetTaskStatus("deny"); s != STATUS_FAIL {
+		t.Fatalf("deny status: %d", s)
+	}
+	var pe *PanicError
+	if err := a.GetTaskErrors()["panic"]; !errors.As(err, &pe) {
+		t.Fatalf("panic error: %v", err)
+	}
+	sort.Strings(calls)
+	if got := strings.Join(calls, " "); got != "auth:0 deny:0 panic:0" {
+		t.Fatalf("calls: %s", got)
+	}
+}
+
+func TestAsync_ARUse(t *testing.T) {
+	var mu sync.Mutex
+	calls := make([]string, 0)
+	ar := NewAR(1, false)
+	ar.Use(traceMiddleware(&mu, &calls))
+	f, _ := ar.Init("t1").CAdd(func(i int) int {
+		return i + 1
+	}, 1).CAdd(func(i int) int {
+		return i * 2
+	}).CDOFuture()
+	ar.AddAndRun("t2", func() {}, nil)
+	ar.Wait()
+	if v := f.Result(); f.Err() != nil || v[0] != 4 {
+		t.Fatalf("t1 result: %v %v", v, f.Err())
+	}
+	if got := strings.Join(calls, " "); got != "t1:-1 t1:0 t1:1 t2:0" {
+		t.Fatalf("calls: %s", got)
+	}
+}
@@ -0,0 +1,100 @@
+package jasync
+
+import (
+	"fmt"
+	"time"
+)
+
+// TaskOption 任务选项
+//
+// 可以与任务参数一起传入Add/AddR/AddAndRun，会在调用任务函数前被剔除；链式任务通过COpt传入
+type TaskOption func(*taskOption)
+
+// 任务选项
+type taskOption struct {
+	timeout  time.Duration // 超时时间，<=0表示不超时
+	retry    *RetryPolicy  // 重试策略，nil表示不重试
+	priority int           // 优先级，值越大越先派发
+	after    []string      // 前置任务名
+	inject   bool          // 是否将前置任务的返回值作为实参传入
+	key      string        // 分组key，同一key的任务受SetKeyLimit的限制
+	group    string        // 任务分组，作为Metrics中的group标签
+	weight   int64         // 任务占用的并发数，<1时按1处理
+	demand   Resources     // 任务对各种资源的需求
+}
+
+// WithTimeout 设置任务的超时时间
+//
+// 超时后任务状态被置为STATUS_TIMEOUT，并释放其占用的并发数。
+// 若任务函数的第一个形参为context.Context，则会传入带有该超时时间的ctx
+func WithTimeout(d time.Duration) TaskOption {
+	return func(o *taskOption) {
+		o.timeout = d
+	}
+}
+
+// WithPriority 设置任务的优先级，默认为0
+//
+// 并发数已满时，Run优先派发优先级高的任务；可通过Async.SetPriorityAging避免低优先级任务饥饿
+func WithPriority(priority int) TaskOption {
+	return func(o *taskOption) {
+		o.priority = priority
+	}
+}
+
+// After 设置任务的前置任务，前置任务都为STATUS_DONE后才会派发该任务
+//
+// 前置任务未成功执行时，该任务被置为STATUS_SKIP；Run时会检查依赖是否存在环
+func After(taskNames ...string) TaskOption {
+	return func(o *taskOption) {
+		o.after = append(o.after, taskNames...)
+	}
+}
+
+// AfterWithResults 同After，并将前置任务的返回值按taskNames的顺序依次作为任务函数的实参，位于其余实参之前
+func AfterWithResults(taskNames ...string) TaskOption {
+	return func(o *taskOption) {
+		o.after = append(o.after, taskNames...)
+		o.inject = true
+	}
+}
+
+// WithWeight 设置任务占用的并发数，默认为1，如大文件下载可占用5个
+//
+// 权重超过最大并发数的任务无法执行：Async中该任务被置为STATUS_FAIL，AsyncRealtime中返回错误。
+// AsyncRealtime开启了自适应并发数时按AdaptiveLimit.Max检查，权重超过当前并发数的任务等待期间并发数至少增大到其权重
+func WithWeight(n int64) TaskOption {
+	return func(o *taskOption) {
+		o.weight = n
+	}
+}
+
+// 任务占用的并发数
+func (o *taskOption) cost() int64 {
+	if o.weight < 1 {
+		return 1
+	}
+	return o.weight
+}
+
+// 检查任务的权重是否超过最大并发数
+func checkWeight(taskName string, weight, limit int64) error {
+	if weight > limit {
+		return fmt.Errorf("任务%s的权重%d超过最大并发数%d", taskName, weight, limit)
+	}
+	return nil
+}
+
+// 从参数中分离出任务选项
+func splitOptions(params []interface{}) (*taskOption, []interface{}) {
+	opt := &taskOption{}
+	args := make([]interface{}, 0, len(params))
+	for _, v := range params {
+		if o, ok := v.(TaskOption); ok {
+			o(opt)
+			continue
+		}
+		args = append(args, v)
+	}
+	return opt, args
+}
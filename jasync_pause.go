@@ -0,0 +1,81 @@
+package jasync
+
+// Pause 暂停派发新的任务，正在执行的任务继续执行，未派发的任务保持STATUS_QUEUE
+//
+// 调用时已被选中派发的任务仍会开始执行；暂停期间Run不返回，可通过ctx取消
+func (a *Async) Pause() {
+	a.mu.Lock()
+	a.paused = true
+	a.cond.Broadcast()
+	a.mu.Unlock()
+}
+
+// Resume 恢复派发任务
+func (a *Async) Resume() {
+	a.mu.Lock()
+	a.paused = false
+	a.cond.Broadcast()
+	a.mu.Unlock()
+}
+
+// Paused 是否已暂停派发任务
+func (a *Async) Paused() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.paused
+}
+
+// Pause 暂停开始新的任务，正在执行的任务继续执行，AddAndRun、CDO阻塞直到恢复或ctx被取消
+//
+// 阻塞期间不占用信号量、key的并发数及资源
+func (ar *AsyncRealtime) Pause() {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if ar.resumed == nil {
+		ar.resumed = make(chan struct{})
+	}
+}
+
+// Resume 恢复开始新的任务
+func (ar *AsyncRealtime) Resume() {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if ar.resumed != nil {
+		close(ar.resumed)
+		ar.resumed = nil
+	}
+}
+
+// Paused 是否已暂停开始新的任务
+func (ar *AsyncRealtime) Paused() bool {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+	return ar.resumed != nil
+}
+
+// 等待直到恢复，ctx被取消时返回ctx.Err()
+func (ar *AsyncRealtime) waitResume() error {
+	ar.mu.RLock()
+	resumed := ar.resumed
+	ar.mu.RUnlock()
+	if resumed == nil {
+		return ar.ctx.Err()
+	}
+	if ar.verbose {
+		jasyncLog.Infof("已暂停，等待恢复\n")
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ar.ctx.Done():
+		return ar.ctx.Err()
+	}
+}
+
+// 进度信息中输出的暂停状态
+func pauseProgress(paused bool) string {
+	if paused {
+		return " paused"
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package jasync
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsync_Pause(t *testing.T) {
+	a := New(false)
+	var started int32
+	for _, name := range []string{"t1", "t2", "t3"} {
+		a.Add(name, func() {
+			atomic.AddInt32(&started, 1)
+			time.Sleep(30 * time.Millisecond)
+		}, nil)
+	}
+	done := make(chan struct{})
+	go func() {
+		a.Run(1)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// 正在执行的任务继续执行，其余任务保持STATUS_QUEUE
+	a.Pause()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&started); n != 1 {
+		t.Fatalf("started while paused: %d", n)
+	}
+	if s1, s2 := a.GetTaskStatus("t1"), a.GetTaskStatus("t2"); s1 != STATUS_DONE || s2 != STATUS_QUEUE || !a.Paused() {
+		t.Fatalf("status while paused: %d %d", s1, s2)
+	}
+	a.Resume()
+	<-done
+	a.Wait()
+	if n := atomic.LoadInt32(&started); n != 3 {
+		t.Fatalf("started after resume: %d", n)
+	}
+}
+
+func TestAsync_PauseRetry(t *testing.T) {
+	a := New(false)
+	var attempts int32
+	a.Add("t1", func() error {
+		// 第一次执行失败，在重试等待期间暂停
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			a.Pause()
+			return errors.New("fail")
+		}
+		return nil
+	}, nil, WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: 20 * time.Millisecond}))
+	a.Add("t2", func() {}, nil)
+	done := make(chan struct{})
+	go func() {
+		a.Run(1)
+		close(done)
+	}()
+	// 暂停期间正在重试的任务仍可重新获取并发数
+	time.Sleep(100 * time.Millisecond)
+	if s1, s2 := a.GetTaskStatus("t1"), a.GetTaskStatus("t2"); s1 != STATUS_DONE || s2 != STATUS_QUEUE {
+		t.Fatalf("status while paused: %d %d", s1, s2)
+	}
+	a.Resume()
+	<-done
+	a.Wait()
+	if s := a.GetTaskStatus("t2"); s != STATUS_DONE {
+		t.Fatalf("t2 after resume: %d", s)
+	}
+}
+
+func TestAsyncRealtime_Pause(t *testing.T) {
+	ar := NewAR(2, false)
+	var started int32
+	ar.AddAndRun("t1", func() { time.Sleep(30 * time.Millisecond) }, nil)
+	ar.Pause()
+	go ar.AddAndRun("t2", func() { atomic.AddInt32(&started, 1) }, nil)
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&started) != 0 || ar.sem.GetCur() != 0 {
+		t.Fatal("started while paused")
+	}
+	ar.Resume()
+	time.Sleep(20 * time.Millisecond)
+	ar.Wait()
+	if atomic.LoadInt32(&started) != 1 || ar.Paused() {
+		t.Fatal("not started after resume")
+	}
+}
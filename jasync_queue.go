@@ -0,0 +1,151 @@
+package jasync
+
+import (
+	"container/heap"
+	"time"
+)
+
+// 任务的派发队列
+//
+// 优先级高的任务先出队，优先级相同时按派发顺序(FIFO/LIFO)出队。
+// aging>0时，任务每在队列中等待aging，其优先级相当于提升1，避免低优先级任务一直得不到执行；
+// 此时入队时间按aging分段，同一段内入队的任务之间仍按派发顺序出队
+type taskQueue struct {
+	ready   taskHeap
+	parked  map[string]*taskHeap // key达到限制的任务，按key分组
+	aging   time.Duration
+	lifo    bool
+	base    int64        // 队列创建时的时间戳，纳秒
+	seq     int          // 入队序号
+	scanned int          // 已检查过的Async.order的长度
+	blocked []*asyncTask // 等待前置任务完成的任务
+}
+
+func newTaskQueue(aging time.Duration, lifo bool) *taskQueue {
+	q := &taskQueue{
+		parked: make(map[string]*taskHeap),
+		aging:  aging,
+		lifo:   lifo,
+		base:   time.Now().UnixNano(),
+	}
+	q.ready.q = q
+	return q
+}
+
+// 任务的排序依据，值越大越先出队，相同时按queueSeq出队
+//
+// 当前时刻的有效优先级为priority+(now-base)/aging-(queueTime-base)/aging，
+// 两个任务比较时now可被消去，因此排序依据不随时间变化。
+// 入队时间按aging取整，同一段内入队的任务排序依据相同，仍按FIFO/LIFO出队，且不会因乘法溢出
+func (q *taskQueue) key(t *asyncTask) int64 {
+	if q.aging <= 0 {
+		return int64(t.opt.priority)
+	}
+	return int64(t.opt.priority) - (t.queueTime-q.base)/int64(q.aging)
+}
+
+// 将任务放入队列，需持有锁
+func (q *taskQueue) push(t *asyncTask, now int64) {
+	t.queueTime = now
+	if q.lifo {
+		t.queueSeq = -q.seq
+	} else {
+		t.queueSeq = q.seq
+	}
+	q.seq++
+	heap.Push(&q.ready, t)
+}
+
+// 取出下一个需要派发的任务，需持有锁
+func (q *taskQueue) pop() *asyncTask {
+	return heap.Pop(&q.ready).(*asyncTask)
+}
+
+// 取出优先级最高且其key未达到限制的任务，并占用该key的一个并发数，需持有锁
+//
+// 没有可以派发的任务时返回nil及需要等待的时间，为0表示需要等待有任务结束
+func (q *taskQueue) popReady(keys *keyLimiter) (*asyncTask, time.Duration) {
+	var wait time.Duration
+	minWait := func(d time.Duration) {
+		if d > 0 && (wait == 0 || d < wait) {
+			wait = d
+		}
+	}
+	// key恢复可用时，将其优先级最高的任务放回队列
+	for key, h := range q.parked {
+		if ok, d := keys.reserve(key, false); !ok {
+			minWait(d)
+			continue
+		}
+		heap.Push(&q.ready, heap.Pop(h))
+		if h.Len() == 0 {
+			delete(q.parked, key)
+		}
+	}
+	for q.ready.Len() > 0 {
+		t := q.pop()
+		if t.TaskStatus.taskStatus != STATUS_QUEUE {
+			continue
+		}
+		ok, d := keys.reserve(t.opt.key, true)
+		if ok {
+			return t, 0
+		}
+		minWait(d)
+		h := q.parked[t.opt.key]
+		if h == nil {
+			h = &taskHeap{q: q}
+			q.parked[t.opt.key] = h
+		}
+		heap.Push(h, t)
+	}
+	return nil, wait
+}
+
+// 队首的任务，需持有锁
+func (q *taskQueue) peek() *asyncTask {
+	return q.ready.tasks[0]
+}
+
+// 队列中的任务数，包括key达到限制的任务
+func (q *taskQueue) Len() int {
+	n := q.ready.Len()
+	for _, h := range q.parked {
+		n += h.Len()
+	}
+	return n
+}
+
+// 按taskQueue.key排序的任务堆
+type taskHeap struct {
+	tasks []*asyncTask
+	q     *taskQueue
+}
+
+func (h *taskHeap) Len() int {
+	return len(h.tasks)
+}
+
+func (h *taskHeap) Less(i, j int) bool {
+	ki, kj := h.q.key(h.tasks[i]), h.q.key(h.tasks[j])
+	if ki != kj {
+		return ki > kj
+	}
+	return h.tasks[i].queueSeq < h.tasks[j].queueSeq
+}
+
+func (h *taskHeap) Swap(i, j int) {
+	h.tasks[i], h.tasks[j] = h.tasks[j], h.tasks[i]
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	h.tasks = append(h.tasks, x.(*asyncTask))
+}
+
+func (h *taskHeap) Pop() interface{} {
+	n := len(h.tasks)
+	t := h.tasks[n-1]
+	h.tasks[n-1] = nil
+	h.tasks = h.tasks[:n-1]
+	return t
+}
@@ -0,0 +1,133 @@
+package jasync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimiter 令牌桶限速器
+//
+// 以每秒rate个的速度生成令牌，最多积攒burst个，每个任务开始执行前消耗一个令牌；rate<=0表示不限速
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	tokens  float64
+	last    time.Time
+	changed chan struct{} // 限速参数变化时关闭，唤醒等待中的协程
+}
+
+// NewRateLimiter 创建令牌桶限速器，burst<1时按1处理
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	l := &RateLimiter{
+		changed: make(chan struct{}),
+	}
+	l.SetLimit(rate, burst)
+	return l
+}
+
+// SetLimit 修改速率与桶容量，可在运行期间调用
+func (l *RateLimiter) SetLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(time.Now())
+	if l.rate <= 0 {
+		// 由不限速改为限速时，桶是满的
+		l.tokens = float64(burst)
+	}
+	l.rate = rate
+	l.burst = burst
+	if l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Limit 获取速率与桶容量
+func (l *RateLimiter) Limit() (rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate, l.burst
+}
+
+// Tokens 获取当前可用的令牌数
+func (l *RateLimiter) Tokens() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(time.Now())
+	return l.tokens
+}
+
+// Wait 等待并消耗一个令牌，ctx被取消时返回ctx.Err()
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		// 先获取changed，避免错过获取令牌之后的参数变化
+		l.mu.Lock()
+		changed := l.changed
+		l.mu.Unlock()
+		ok, d := l.reserve(true)
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// 按经过的时间生成令牌，需持有锁
+func (l *RateLimiter) advance(now time.Time) {
+	if l.rate > 0 && !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+}
+
+// 进度输出中的限速信息，不限速时为空
+func (l *RateLimiter) progress() string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return ""
+	}
+	l.advance(time.Now())
+	return fmt.Sprintf(" rate:%g/s burst:%d tokens:%.1f", l.rate, l.burst, l.tokens)
+}
+
+// 尝试获取一个令牌，take为false时只检查不消耗；获取不到时返回需要等待的时间
+func (l *RateLimiter) reserve(take bool) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return true, 0
+	}
+	l.advance(time.Now())
+	if l.tokens >= 1 {
+		if take {
+			l.tokens--
+		}
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
@@ -0,0 +1,72 @@
+package jasync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(20, 2)
+	start := time.Now()
+	// 前2个令牌可以直接获取，之后每50ms生成一个
+	for i := 0; i < 6; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 180*time.Millisecond || d > 400*time.Millisecond {
+		t.Fatalf("elapsed: %v", d)
+	}
+	// 等待期间调整速率
+	l.SetLimit(0.1, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l.SetLimit(1000, 1)
+	}()
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("elapsed: %v", d)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	l.SetLimit(0.1, 1)
+	l.Wait(ctx)
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestAsync_SetRateLimit(t *testing.T) {
+	a := New(false)
+	a.SetRateLimit(50, 1)
+	for i := 0; i < 5; i++ {
+		a.Add("", func() {}, nil)
+	}
+	start := time.Now()
+	a.Run(5)
+	a.Wait()
+	if d := time.Since(start); d < 70*time.Millisecond {
+		t.Fatalf("elapsed: %v", d)
+	}
+
+	ar := NewAR(5, false)
+	ar.SetRateLimit(50, 1)
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		ar.AddAndRun("", func() {}, nil)
+		ar.Init("").CAdd(func() {}).CDO()
+	}
+	ar.Wait()
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatalf("elapsed: %v", d)
+	}
+	if ar.GetStatusCount(STATUS_DONE) != 6 {
+		t.Fatalf("done: %d", ar.GetStatusCount(STATUS_DONE))
+	}
+}
@@ -26,15 +26,50 @@ type AsyncRealtime struct {
 	HandlerValues []reflect.Value
 	// 池
 	pool *sync.Pool
+	// ctx被取消后不再派发新的任务
+	ctx context.Context
+	// 各状态的任务数量
+	statusCount map[int]int64
+	// 任务开始执行前的限速
+	limiter *RateLimiter
+	// 按key的并发数与速率限制
+	keys *keyLimiter
+	// 调度器指标
+	metrics *Metrics
+	// 任务状态变化时调用的钩子函数
+	hooks *hooks
+	// 包装任务函数调用的中间件
+	middlewares []Middleware
+	// 追踪任务执行的Tracer
+	tracer Tracer
+	// 自适应并发数的控制器，nil表示不开启
+	adaptive *adaptiveLimiter
+	// 等待信号量的权重大于1的任务，权重->任务数
+	waiting map[int64]int
+	// 任务通过WithResources声明的资源需求所使用的信号量
+	resources *MultiWeighted
+	// 暂停期间不为nil，恢复时关闭
+	resumed chan struct{}
 }
 
 // New 创建一个新的异步执行对象
 //
 // verbose: 是否显示进度条,默认显示
 func NewAR(count int64, verbose ...bool) *AsyncRealtime {
+	return NewARContext(context.Background(), count, verbose...)
+}
+
+// NewARContext 创建一个新的异步执行对象，ctx被取消后不再派发新的任务
+//
+// verbose: 是否显示进度条,默认显示
+func NewARContext(ctx context.Context, count int64, verbose ...bool) *AsyncRealtime {
 	var ar *AsyncRealtime
 	if len(verbose) == 0 {
 		ar = &AsyncRealtime{
+			ctx:            ctx,
+			statusCount:    make(map[int]int64),
+			limiter:        NewRateLimiter(0, 0),
+			keys:           newKeyLimiter(),
 			mu:             new(sync.RWMutex),
 			verbose:        false,
 			sem:            NewWeighted(count),
@@ -47,6 +82,8 @@ func NewAR(count int64, verbose ...bool) *AsyncRealtime {
 						handlerValues:   make([]reflect.Value, 0),
 						inParamsValues:  make([][]reflect.Value, 0),
 						outParamsValues: make([][]reflect.Kind, 0),
+						withCtx:         make([]bool, 0),
+						opt:             &taskOption{},
 						handlerNum:      0,
 						AsyncRealtime:   nil,
 					}
@@ -55,6 +92,10 @@ func NewAR(count int64, verbose ...bool) *AsyncRealtime {
 		}
 	} else {
 		ar = &AsyncRealtime{
+			ctx:            ctx,
+			statusCount:    make(map[int]int64),
+			limiter:        NewRateLimiter(0, 0),
+			keys:           newKeyLimiter(),
 			mu:             new(sync.RWMutex),
 			verbose:        verbose[0],
 			sem:            NewWeighted(count),
@@ -67,6 +108,8 @@ func NewAR(count int64, verbose ...bool) *AsyncRealtime {
 						handlerValues:   make([]reflect.Value, 0),
 						inParamsValues:  make([][]reflect.Value, 0),
 						outParamsValues: make([][]reflect.Kind, 0),
+						withCtx:         make([]bool, 0),
+						opt:             &taskOption{},
 						handlerNum:      0,
 						AsyncRealtime:   nil,
 					}
@@ -78,7 +121,10 @@ func NewAR(count int64, verbose ...bool) *AsyncRealtime {
 	if ar.verbose {
 		print1 := func() {
 			cur := ar.sem.GetCur()
-			fmt.Printf("%d/%d\n", cur, ar.maxConcurrency)
+			ar.mu.RLock()
+			max, adaptive, paused := ar.maxConcurrency, ar.adaptive.progress(), pauseProgress(ar.resumed != nil)
+			ar.mu.RUnlock()
+			fmt.Printf("%d/%d%s%s%s%s\n", cur, max, paused, adaptive, ar.resources.progress(), ar.limiter.progress())
 		}
 		interval := time.Second * 10
 		go func() {
@@ -86,6 +132,8 @@ func NewAR(count int64, verbose ...bool) *AsyncRealtime {
 				select {
 				case <-time.After(interval):
 					print1()
+				case <-ar.ctx.Done():
+					return
 				}
 			}
 		}()
@@ -113,25 +161,308 @@ func (ar *AsyncRealtime) Done() <-chan struct{} {
 	return revOnly
 }
 
+// GetStatusCount 获取处于某状态的任务数量
+func (ar *AsyncRealtime) GetStatusCount(status int) int64 {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+	return ar.statusCount[status]
+}
+
+func (ar *AsyncRealtime) addStatusCount(status int) {
+	ar.mu.Lock()
+	ar.statusCount[status]++
+	ar.mu.Unlock()
+}
+
+// 记录任务结束时的状态，任务发生panic时输出错误信息
+//
+// ctx 任务执行期间使用的ctx；beg 任务开始执行的时间；f 任务的Future，可为nil；span 任务的span，可为nil
+func (ar *AsyncRealtime) finish(ctx context.Context, taskName string, opt *taskOption, beg time.Time, f *Future, span Span, status int, values []interface{}, err error) {
+	// ctx被取消的任务
+	if status != STATUS_DONE && ctx.Err() == context.Canceled {
+		status = STATUS_CANCEL
+	}
+	status, err = f.finalStatus(status, err)
+	ar.addStatusCount(status)
+	ar.adapt(status, time.Since(beg))
+	ar.metrics.finish(opt.group, status, time.Since(beg))
+	ar.callHooks(hookFinish, TaskResult{Name: taskName, Status: status, Values: values, Err: err, BegTime: beg, EndTime: time.Now()})
+	endSpan(span, status, err)
+	if _, ok := err.(*PanicError); ok {
+		jasyncLog.Errorf("%s %v\n", taskName, err)
+	}
+	if f != nil {
+		f.finish(status, values, err)
+	}
+}
+
+// 任务结束或重试等待前释放信号量、资源及key的并发数
+func (ar *AsyncRealtime) release(opt *taskOption) {
+	ar.sem.Release(opt.cost())
+	releaseResources(ar.resources, opt.demand)
+	ar.keys.release(opt.key)
+}
+
+// 任务重试等待结束后重新获取key的并发数、资源及信号量
+func (ar *AsyncRealtime) reacquire(ctx context.Context, opt *taskOption) error {
+	if err := ar.keys.acquire(ctx, opt.key); err != nil {
+		return err
+	}
+	err := acquireResources(ctx, ar.resources, opt.demand)
+	if err == nil {
+		err = ar.sem.Acquire(ctx, opt.cost())
+		if err == nil {
+			err = ar.waitRate(ctx, opt.cost())
+		}
+		if err != nil {
+			releaseResources(ar.resources, opt.demand)
+		}
+	}
+	if err != nil {
+		ar.keys.release(opt.key)
+		return err
+	}
+	return nil
+}
+
+// 任务开始执行前获取key的并发数、信号量并等待限速，返回任务开始执行的时间及等待的时间
+//
+// try 是否先尝试不阻塞地获取信号量，需要阻塞时输出提示
+func (ar *AsyncRealtime) admit(taskName string, opt *taskOption, try bool) (time.Time, time.Duration, error) {
+	begin := time.Now()
+	err := checkWeight(taskName, opt.cost(), ar.capacity())
+	if err == nil {
+		err = checkResources(ar.resources, taskName, opt.demand)
+	}
+	if err != nil {
+		return begin, 0, err
+	}
+	ar.metrics.submit(opt.group)
+	ar.metrics.queue(opt.group, 1)
+	ar.callHooks(hookQueued, TaskResult{Name: taskName, Status: STATUS_QUEUE})
+	// 未能开始执行的任务记录为取消状态
+	cancel := func(err error) {
+		ar.metrics.queue(opt.group, -1)
+		ar.metrics.discard(opt.group, STATUS_CANCEL)
+		ar.callHooks(hookFinish, TaskResult{Name: taskName, Status: STATUS_CANCEL, Err: err, EndTime: time.Now()})
+	}
+	defer ar.waitWeight(opt.cost())()
+	for {
+		// 暂停期间不开始新的任务
+		if err := ar.waitResume(); err != nil {
+			ar.addStatusCount(STATUS_CANCEL)
+			cancel(err)
+			return begin, 0, err
+		}
+		if err := ar.acquireAll(opt, try); err != nil {
+			cancel(err)
+			return begin, 0, err
+		}
+		if !ar.Paused() {
+			break
+		}
+		// 获取期间被暂停时，释放后重新等待恢复
+		ar.release(opt)
+		try = false
+	}
+	now := time.Now()
+	ar.metrics.queue(opt.group, -1)
+	ar.metrics.start(opt.group, now.Sub(begin))
+	ar.callHooks(hookStart, TaskResult{Name: taskName, Status: STATUS_DOING, BegTime: now})
+	return now, now.Sub(begin), nil
+}
+
+// 任务权重的上限：开启了自适应并发数时为其最大并发数，否则为当前的最大并发数
+//
+// 开启了自适应并发数时，权重超过当前并发数的任务等待期间并发数至少增大到其权重，见waitWeight
+func (ar *AsyncRealtime) capacity() int64 {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+	if ar.adaptive != nil {
+		return ar.adaptive.cfg.Max
+	}
+	return ar.maxConcurrency
+}
+
+// 依次获取key的并发数、资源、信号量并等待限速，失败时释放已获取的部分并记录为取消状态
+//
+// try 是否先尝试不阻塞地获取信号量，需要阻塞时输出提示
+func (ar *AsyncRealtime) acquireAll(opt *taskOption, try bool) error {
+	if err := ar.acquireKey(opt.key); err != nil {
+		return err
+	}
+	if err := acquireResources(ar.ctx, ar.resources, opt.demand); err != nil {
+		ar.keys.release(opt.key)
+		ar.addStatusCount(STATUS_CANCEL)
+		return err
+	}
+	held := false
+	if try {
+		held = ar.ctx.Err() == nil && ar.sem.TryAcquire(opt.cost())
+		if !held && ar.verbose {
+			// 显示信息
+			jlog.Info("Block To Acquire Semaphore")
+		}
+	}
+	if err := ar.acquire(held, opt.cost()); err != nil {
+		releaseResources(ar.resources, opt.demand)
+		ar.keys.release(opt.key)
+		return err
+	}
+	return nil
+}
+
+// SetMetrics 设置记录调度器指标的Metrics，需在添加任务前调用
+func (ar *AsyncRealtime) SetMetrics(m *Metrics) {
+	ar.metrics = m
+}
+
+// 获取key的并发数，ctx被取消时返回错误并记录为取消状态
+func (ar *AsyncRealtime) acquireKey(key string) error {
+	if err := ar.keys.acquire(ar.ctx, key); err != nil {
+		ar.addStatusCount(STATUS_CANCEL)
+		return err
+	}
+	return nil
+}
+
+// 获取信号量并等待限速，ctx被取消时返回错误并记录为取消状态
+//
+// held 是否已经获取了信号量；n 任务的权重
+func (ar *AsyncRealtime) acquire(held bool, n int64) error {
+	err := ar.ctx.Err()
+	if err == nil && !held {
+		err = ar.sem.Acquire(ar.ctx, n)
+		held = err == nil
+	}
+	if err == nil {
+		err = ar.waitRate(ar.ctx, n)
+		held = false
+	}
+	if err != nil {
+		if held {
+			ar.sem.Release(n)
+		}
+		ar.addStatusCount(STATUS_CANCEL)
+		return err
+	}
+	return nil
+}
+
+// 等待限速，失败时释放已获取的信号量
+func (ar *AsyncRealtime) waitRate(ctx context.Context, n int64) error {
+	if err := ar.limiter.Wait(ctx); err != nil {
+		ar.sem.Release(n)
+		return err
+	}
+	return nil
+}
+
+// SetKeyLimit 设置通过WithKey分组的任务的并发数与速率限制，key为空时设置所有未单独设置的key的默认限制
+//
+// 可在运行期间调用；key达到限制时AddAndRun、CDO阻塞，此时不占用全局的并发数
+func (ar *AsyncRealtime) SetKeyLimit(key string, limit KeyLimit) {
+	ar.keys.setLimit(key, limit)
+}
+
+// KeyStats 获取各key的统计信息，Waiting为阻塞等待该key的任务数
+func (ar *AsyncRealtime) KeyStats() map[string]KeyStats {
+	return ar.keys.stats()
+}
+
+// SetRateLimit 设置任务开始执行的速率限制，每秒最多开始rate个任务，允许突发burst个，rate<=0表示不限速
+//
+// 可在运行期间调用；重试时每次尝试同样受限，任务链按一个任务计算
+func (ar *AsyncRealtime) SetRateLimit(rate float64, burst int) {
+	ar.limiter.SetLimit(rate, burst)
+}
+
+// SetConcurrency 设置最大并发数，可在运行期间调用
+//
+// 增大时立即唤醒等待的任务；减小时正在执行的任务不受影响，直至并发数降到n以下才开始新的任务。
+// 开启了自适应并发数时，n被限制在其范围内，并从n开始继续调整
+func (ar *AsyncRealtime) SetConcurrency(n int64) error {
+	if n <= 0 {
+		return fmt.Errorf("并发数必须大于0: %d", n)
+	}
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if ar.adaptive != nil {
+		ar.adaptive.limit = ar.adaptive.clamp(n)
+		ar.fitWaiting()
+		n = ar.adaptive.limit
+	}
+	ar.setConcurrency(n)
+	return nil
+}
+
+// 修改最大并发数，需持有锁
+func (ar *AsyncRealtime) setConcurrency(n int64) {
+	ar.maxConcurrency = n
+	ar.sem.Resize(n)
+}
+
+// AddAndRun 添加任务并立即执行，达到最大并发数时阻塞
+//
+// ctx被取消后不再执行，返回ctx.Err()
 func (ar *AsyncRealtime) AddAndRun(name string, funcHandler interface{}, printHandler interface{}, params ...interface{}) (task_name string, b_success bool, err error) {
-	ar.wg.Add(1)
+	task_name, _, err = ar.addAndRun(name, funcHandler, printHandler, false, params...)
+	return task_name, err == nil, err
+}
+
+// AddAndRunFuture 添加任务并立即执行，返回任务的Future，参数同AddAndRun
+func (ar *AsyncRealtime) AddAndRunFuture(name string, funcHandler interface{}, printHandler interface{}, params ...interface{}) (*Future, error) {
+	_, f, err := ar.addAndRun(name, funcHandler, printHandler, true, params...)
+	return f, err
+}
+
+func (ar *AsyncRealtime) addAndRun(name string, funcHandler interface{}, printHandler interface{}, withFuture bool, params ...interface{}) (task_name string, f *Future, err error) {
 	if name == "" {
 		var err2 error
 		name, err2 = uuid.GenerateUUID()
 		if err2 != nil {
-			return "", false, err2
+			return "", nil, err2
 		}
 	}
-	// 获取信号量
-	ar.sem.Acquire(context.Background(), 1)
+	task_name = name
 	// 判断传入的是否是函数
 	handlerValue := reflect.ValueOf(funcHandler)
 	if handlerValue.Kind() != reflect.Func {
-		return "", false, fmt.Errorf("invalid func handler")
+		return task_name, nil, fmt.Errorf(handlerValue.String() + " 不符合格式func(参数...)(返回...){}")
+	}
+	opt, params := splitOptions(params)
+	beg, wait, err := ar.admit(task_name, opt, false)
+	if err != nil {
+		return task_name, nil, err
+	}
+	ctx, cancel := context.WithCancel(ar.ctx)
+	ctx, span := startSpan(ar.tracer, ctx, task_name, opt, wait)
+	if withFuture {
+		f = newFuture(task_name)
+		f.status = STATUS_DOING
+		f.cancel = cancel
 	}
+	ar.wg.Add(1)
 	go func(params ...interface{}) {
+		var taskErr error
+		var taskResult []interface{}
+		status := STATUS_DONE
+		// 重试等待期间被取消时，信号量已被释放
+		held := true
 		defer ar.wg.Done()
-		defer ar.sem.Release(1)
+		defer func() {
+			// printHandler发生panic时，任务同样视为失败
+			if r := recover(); r != nil {
+				taskErr = newPanicError(r)
+				status = STATUS_FAIL
+			}
+			// 先释放信号量、资源与key，再标记任务结束
+			if held {
+				ar.release(opt)
+			}
+			ar.finish(ctx, task_name, opt, beg, f, span, status, taskResult, taskErr)
+			cancel()
+		}()
 
 		paramNum := len(params)
 		//jlog.Info("params:", params)
@@ -142,37 +473,39 @@ func (ar *AsyncRealtime) AddAndRun(name string, funcHandler interface{}, printHa
 			}
 		}
 
-		// 运行函数
-		values := handlerValue.Call(params_list)
+		// 运行函数，失败时按重试策略重试
+		withCtx := needContext(handlerValue.Type(), paramNum)
+		var values []reflect.Value
+		status, held, taskErr = retryRun(ctx, opt.retry, func(attempt int) (int, error) {
+			var err error
+			values, err = callHandler(ctx, opt, ar.invoker(), task_name, handlerValue, withCtx, params_list)
+			if err != nil {
+				// 超时或panic
+				return statusOfErr(err), err
+			}
+			// 任务函数最后一个返回值为非nil的error时，任务视为失败
+			if err = lastError(values); err != nil {
+				return STATUS_FAIL, err
+			}
+			return STATUS_DONE, nil
+		}, func() {
+			ar.release(opt)
+		}, func(ctx context.Context) error {
+			return ar.reacquire(ctx, opt)
+		})
+		if values == nil {
+			return
+		}
+		taskResult = valuesToInterfaces(values)
 		//
 		var printHandlerValue reflect.Value
 		if printHandler != nil && reflect.ValueOf(printHandler).Kind() == reflect.Func {
 			printHandlerValue = reflect.ValueOf(printHandler)
 		}
 		// 传入的函数执行的结果保存在values中
-		if valuesNum := len(values); valuesNum > 0 {
-			resultItems := make([]interface{}, valuesNum)
-			// asyncTaskKey:int,asyncTaskVal:value
-			for k, v := range values {
-				resultItems[k] = v.Interface()
-			}
-			//taskResult = resultItems
-			// 如果传入了printHandler,并且reqHandler函数返回参数的个数与printHandler函数形参个数相同
-			if printHandlerValue.IsValid() && handlerValue.Type().NumOut() == printHandlerValue.Type().NumIn() {
-				paramsArg := make([]reflect.Value, len(resultItems))
-				for k, v := range resultItems {
-					if reflect.ValueOf(v).IsValid() {
-						paramsArg[k] = reflect.ValueOf(v)
-					} else {
-						paramsArg[k] = reflect.Zero(printHandlerValue.Type().In(k))
-					}
-				}
-				// 调用printHandler
-				printHandlerValue.Call(paramsArg)
-			}
-		}
+		callPrintHandler(handlerValue, printHandlerValue, taskResult)
 	}(params...)
-	return task_name, false, fmt.Errorf(handlerValue.String() + " 不符合格式func(参数...)(返回...){}")
+	return task_name, f, nil
 }
 
 func (art *AsyncRealtimeTask) CAdd(funcHandler interface{}, params ...interface{}) *AsyncRealtimeTask {
@@ -200,17 +533,24 @@ func (art *AsyncRealtimeTask) CAdd(funcHandler interface{}, params ...interface{
 		art.err = fmt.Errorf("传入的不是函数")
 		return art
 	}
+	// 第一个形参为context.Context时注入ctx，其余形参从off开始
+	var withCtx bool
+	var off int
 	// 判断是否是添加的第一个函数
 	if art.handlerNum == 0 {
+		withCtx = needContext(handlerValue.Type(), len(params))
+		if withCtx {
+			off = 1
+		}
 		// 判断函数的形参个数，与传入的实参个数是否相同
-		if handlerValue.Type().NumIn() != len(params) {
+		if handlerValue.Type().NumIn() != len(params)+off {
 			art.err = fmt.Errorf("形参与实参个数不同")
 			return art
 		}
 		// 判断本函数的输入参数类型 是否等于 本函数形参类型
 		for k, param := range params {
-			if reflect.ValueOf(param).Kind() != handlerValue.Type().In(k).Kind() {
-				art.err = fmt.Errorf("形参与实参类型不同:%d", k)
+			if reflect.ValueOf(param).Kind() != handlerValue.Type().In(k+off).Kind() {
+				art.err = fmt.Errorf("形参与实参类型不同:%d", k+off)
 				return art
 			}
 		}
@@ -218,27 +558,32 @@ func (art *AsyncRealtimeTask) CAdd(funcHandler interface{}, params ...interface{
 	} else {
 		// 上一个函数的输出参数
 		lastHandlerOutKinds := art.outParamsValues[art.handlerNum-1]
+		withCtx = needContext(handlerValue.Type(), len(lastHandlerOutKinds)+len(params))
+		if withCtx {
+			off = 1
+		}
 		// 判断上个函数的输出参数个数+本函数的输入参数个数是否等于本函数的形参个数
-		if len(lastHandlerOutKinds)+len(params) != handlerValue.Type().NumIn() {
+		if len(lastHandlerOutKinds)+len(params)+off != handlerValue.Type().NumIn() {
 			art.err = fmt.Errorf("上个函数的输出参数个数(%d)+本函数的输入参数个数(%d) != 本函数的形参个数(%d)", len(lastHandlerOutKinds), len(params), handlerValue.Type().NumIn())
 			return art
 		}
 		// 判断上个函数的输出参数的类型+本函数的输入参数类型 是否等于 本函数形参类型
 		for k, lastOutKind := range lastHandlerOutKinds {
-			if lastOutKind != handlerValue.Type().In(k).Kind() {
-				art.err = fmt.Errorf("形参与实参类型不同:%d", k)
+			if lastOutKind != handlerValue.Type().In(k+off).Kind() {
+				art.err = fmt.Errorf("形参与实参类型不同:%d", k+off)
 				return art
 			}
 		}
 		// 判断本函数的输入参数类型 是否等于 本函数形参类型
 		for k, param := range params {
-			if reflect.ValueOf(param).Kind() != handlerValue.Type().In(k+len(lastHandlerOutKinds)).Kind() {
-				art.err = fmt.Errorf("形参与实参类型不同:%d", k+len(lastHandlerOutKinds))
+			if reflect.ValueOf(param).Kind() != handlerValue.Type().In(k+off+len(lastHandlerOutKinds)).Kind() {
+				art.err = fmt.Errorf("形参与实参类型不同:%d", k+off+len(lastHandlerOutKinds))
 				return art
 			}
 		}
 		art.handlerNum += 1
 	}
+	art.withCtx = append(art.withCtx, withCtx)
 
 	// 函数输出的参数
 	outParamNum := handlerValue.Type().NumOut()
@@ -266,49 +611,176 @@ func (art *AsyncRealtimeTask) CAdd(funcHandler interface{}, params ...interface{
 }
 
 // CDO 如果设置了waitTime，则等待指定的时间后，才进行相关操作
+//
+// ctx被取消后不再执行，返回ctx.Err()
+//
+// waitTime不再推荐使用，请通过AsyncRealtime.SetRateLimit限速
 func (art *AsyncRealtimeTask) CDO(waitTime ...time.Duration) (err error) {
+	_, err = art.cdo(false, waitTime...)
+	return err
+}
+
+// CDOFuture 同CDO，并返回任务链的Future，Future.Result()为最后一个函数的返回值
+func (art *AsyncRealtimeTask) CDOFuture(waitTime ...time.Duration) (*Future, error) {
+	return art.cdo(true, waitTime...)
+}
+
+func (art *AsyncRealtimeTask) cdo(withFuture bool, waitTime ...time.Duration) (f *Future, err error) {
 	if art == nil {
-		return fmt.Errorf("art对象为nil")
+		return nil, fmt.Errorf("art对象为nil")
 	}
 	if art.err != nil {
 		//jlog.Error(art.err)
-		return art.err
+		return nil, art.err
 	}
 
 	// 240526 等待时间
 	if len(waitTime) > 0 {
-		time.Sleep(waitTime[0])
-	}
-	//
-	art.wg.Add(1)
-	if !art.sem.TryAcquire(1) {
-		if art.verbose {
-			// 显示信息
-			jlog.Info("Block To Acquire Semaphore")
+		select {
+		case <-time.After(waitTime[0]):
+		case <-art.ctx.Done():
 		}
-		// 获取信号量
-		art.sem.Acquire(context.Background(), 1)
 	}
+	opt := art.opt
+	beg, wait, err := art.admit(art.taskName, art.opt, true)
+	if err != nil {
+		art.Clean()
+		art.pool.Put(art)
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(art.ctx)
+	ctx, span := startSpan(art.tracer, ctx, art.taskName, art.opt, wait)
+	if withFuture {
+		f = newFuture(art.taskName)
+		f.status = STATUS_DOING
+		f.cancel = cancel
+	}
+	art.wg.Add(1)
 
 	go func() {
+		var taskErr error
+		var taskResult []interface{}
+		status := STATUS_DONE
+		// 重试等待期间被取消时，信号量已被释放
+		held := true
+		// 超时的任务链仍在后台执行，不能放回池中复用
+		timedOut := false
+		taskName := art.taskName
 		defer art.wg.Done()
-		defer art.sem.Release(1)
-		defer art.pool.Put(art)
-		defer art.Clean()
-		lastOutValues := make([]reflect.Value, 0)
-		for k, handlerValue := range art.handlerValues {
-			lastOutValues = append(lastOutValues, art.inParamsValues[k]...)
-			lastOutValues = handlerValue.Call(lastOutValues)
-		}
+		defer func() {
+			if held {
+				art.release(opt)
+			}
+			art.finish(ctx, taskName, art.opt, beg, f, span, status, taskResult, taskErr)
+			cancel()
+			if !timedOut {
+				art.Clean()
+				art.pool.Put(art)
+			}
+		}()
+		// 重试时重新执行整个任务链
+		status, held, taskErr = retryRun(ctx, art.opt.retry, func(attempt int) (int, error) {
+			values, status, err := art.call(ctx)
+			if status == STATUS_TIMEOUT {
+				timedOut = true
+			}
+			taskResult = nil
+			if values != nil {
+				taskResult = valuesToInterfaces(values)
+			}
+			return status, err
+		}, func() {
+			art.release(opt)
+		}, func(ctx context.Context) error {
+			return art.reacquire(ctx, opt)
+		})
 		//jlog.Info("done")
 	}()
-	return nil
+	return f, nil
+}
+
+// 执行一次任务链
+func (art *AsyncRealtimeTask) call(ctx context.Context) ([]reflect.Value, int, error) {
+	if art.opt.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, art.opt.timeout)
+		defer cancel()
+	}
+	// 整个任务链与链中的每个函数都被中间件包装
+	invoke := art.invoker()
+	runChain := func(ctx context.Context, inv *Invocation) ([]reflect.Value, error) {
+		var lastOutValues []reflect.Value
+		for k, handlerValue := range art.handlerValues {
+			// 链中的后续函数在ctx被取消后不再执行
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			args := inv.Args
+			if k > 0 {
+				args = append(lastOutValues, art.inParamsValues[k]...)
+			}
+			var err error
+			lastOutValues, err = art.callStep(ctx, invoke, k, handlerValue, args)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return lastOutValues, nil
+	}
+	chain := &Invocation{TaskName: art.taskName, Step: -1, Args: art.inParamsValues[0]}
+	values, err := callWithTimeout(art.opt.timeout, func() ([]reflect.Value, error) {
+		return chainMiddleware(art.getMiddlewares(), runChain)(ctx, chain)
+	})
+	if err != nil {
+		return nil, statusOfErr(err), err
+	}
+	// 最后一个函数的最后一个返回值为非nil的error时，任务视为失败；中间函数返回的error作为下个函数的实参
+	if err = lastError(values); err != nil {
+		return values, STATUS_FAIL, err
+	}
+	return values, STATUS_DONE, nil
+}
+
+// 调用任务链中的第k个函数，设置了Tracer时为其创建子span
+func (art *AsyncRealtimeTask) callStep(ctx context.Context, invoke Invoker, k int, handlerValue reflect.Value, args []reflect.Value) (values []reflect.Value, err error) {
+	if art.tracer != nil {
+		var span Span
+		ctx, span = art.tracer.Start(ctx, fmt.Sprintf("%s/%d", art.taskName, k))
+		span.SetAttributes(Attribute{"jasync.task", art.taskName}, Attribute{"jasync.step", k})
+		defer func() {
+			// 函数发生panic时同样结束span
+			if r := recover(); r != nil {
+				err = newPanicError(r)
+			}
+			if err != nil {
+				span.RecordError(err)
+			}
+			span.End()
+		}()
+	}
+	if art.withCtx[k] {
+		args = append([]reflect.Value{reflect.ValueOf(ctx)}, args...)
+	}
+	return invoke(ctx, &Invocation{TaskName: art.taskName, Step: k, Handler: handlerValue, Args: args})
+}
+
+// COpt 设置任务链的选项，如WithTimeout、WithRetry，超时时间针对整个任务链，重试时重新执行整个任务链
+func (art *AsyncRealtimeTask) COpt(opts ...TaskOption) *AsyncRealtimeTask {
+	if art == nil {
+		return nil
+	}
+	for _, o := range opts {
+		o(art.opt)
+	}
+	return art
 }
 
 func (art *AsyncRealtimeTask) Clean() {
 	art.handlerValues = art.HandlerValues[:0]
 	art.inParamsValues = art.inParamsValues[:0]
 	art.outParamsValues = art.outParamsValues[:0]
+	art.withCtx = art.withCtx[:0]
+	art.opt = &taskOption{}
 	art.err = nil
 	art.handlerNum = 0
 }
@@ -320,6 +792,8 @@ type AsyncRealtimeTask struct {
 	handlerValues   []reflect.Value
 	inParamsValues  [][]reflect.Value
 	outParamsValues [][]reflect.Kind
+	withCtx         []bool // 各函数是否需要注入ctx
+	opt             *taskOption
 	err             error
 }
 
@@ -1,9 +1,11 @@
 package jasync
 
 import (
+	"context"
 	"fmt"
 	"github.com/chroblert/jlog"
 	"github.com/schollz/progressbar/v3"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -58,3 +60,101 @@ func TestAsync_ChainAdd(t *testing.T) {
 	a.Wait()
 	jlog.Infof("end")
 }
+
+func TestAsync_NewARContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := NewARContext(ctx, 1)
+	if _, ok, err := a.AddAndRun("t1", func() {
+		time.Sleep(200 * time.Millisecond)
+	}, nil); !ok || err != nil {
+		t.Fatalf("AddAndRun: %v,%v", ok, err)
+	}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, ok, err := a.AddAndRun("t2", func() {}, nil); ok || err == nil {
+		t.Fatalf("AddAndRun after cancel: %v,%v", ok, err)
+	}
+	if err := a.Init("t3").CAdd(func() {}).CDO(); err == nil {
+		t.Fatal("CDO after cancel should fail")
+	}
+	a.Wait()
+	if a.GetStatusCount(STATUS_CANCEL) != 2 || a.GetStatusCount(STATUS_DONE) != 1 {
+		t.Fatalf("status count: cancel %d,done %d", a.GetStatusCount(STATUS_CANCEL), a.GetStatusCount(STATUS_DONE))
+	}
+}
+
+func TestAsync_ARWithTimeout(t *testing.T) {
+	a := NewAR(1)
+	a.AddAndRun("t1", func(ctx context.Context) {
+		<-ctx.Done()
+	}, nil, WithTimeout(50*time.Millisecond))
+	// 超时后释放并发数，后续任务可继续执行
+	if err := a.Init("t2").CAdd(func(ctx context.Context, i int) int {
+		return i
+	}, 1).CAdd(func(i int) {
+		time.Sleep(time.Second)
+	}).COpt(WithTimeout(50 * time.Millisecond)).CDO(); err != nil {
+		t.Fatal(err)
+	}
+	a.AddAndRun("t3", func() {}, nil)
+	a.Wait()
+	if a.GetStatusCount(STATUS_TIMEOUT) != 2 || a.GetStatusCount(STATUS_DONE) != 1 {
+		t.Fatalf("status count: timeout %d,done %d", a.GetStatusCount(STATUS_TIMEOUT), a.GetStatusCount(STATUS_DONE))
+	}
+}
+
+func TestAsync_ARPanic(t *testing.T) {
+	a := NewAR(1)
+	a.AddAndRun("t1", func() {
+		panic("t1")
+	}, nil)
+	a.Init("t2").CAdd(func() int {
+		return 1
+	}).CAdd(func(i int) {
+		panic("t2")
+	}).CDO()
+	a.AddAndRun("t3", func() {}, nil)
+	a.Wait()
+	if a.GetStatusCount(STATUS_FAIL) != 2 || a.GetStatusCount(STATUS_DONE) != 1 {
+		t.Fatalf("status count: fail %d,done %d", a.GetStatusCount(STATUS_FAIL), a.GetStatusCount(STATUS_DONE))
+	}
+}
+
+func TestAsync_ARTaskErrors(t *testing.T) {
+	a := NewAR(2)
+	a.AddAndRun("t1", func() (int, error) {
+		return 0, fmt.Errorf("t1 failed")
+	}, nil)
+	a.Init("t2").CAdd(func() (int, error) {
+		return 0, fmt.Errorf("t2 failed")
+	}).CAdd(func(i int, err error) error {
+		return nil
+	}).CDO()
+	a.Init("t3").CAdd(func() error {
+		return fmt.Errorf("t3 failed")
+	}).CDO()
+	a.Wait()
+	if a.GetStatusCount(STATUS_FAIL) != 2 || a.GetStatusCount(STATUS_DONE) != 1 {
+		t.Fatalf("status count: fail %d,done %d", a.GetStatusCount(STATUS_FAIL), a.GetStatusCount(STATUS_DONE))
+	}
+}
+
+func TestAsync_ARWithRetry(t *testing.T) {
+	a := NewAR(1)
+	var n1, n2 int32
+	retry := WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond})
+	a.AddAndRun("t1", func() error {
+		if atomic.AddInt32(&n1, 1) < 3 {
+			return fmt.Errorf("t1 failed")
+		}
+		return nil
+	}, nil, retry)
+	a.Init("t2").CAdd(func() int {
+		return int(atomic.AddInt32(&n2, 1))
+	}).CAdd(func(i int) error {
+		return fmt.Errorf("t2 failed:%d", i)
+	}).COpt(retry).CDO()
+	a.Wait()
+	if n1 != 3 || n2 != 3 || a.GetStatusCount(STATUS_FAIL) != 1 || a.GetStatusCount(STATUS_DONE) != 1 {
+		t.Fatalf("attempts: %d,%d,status count: fail %d,done %d", n1, n2, a.GetStatusCount(STATUS_FAIL), a.GetStatusCount(STATUS_DONE))
+	}
+}
@@ -0,0 +1,285 @@
+package jasync
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Registry 任务函数注册表
+//
+// 通过名称引用任务函数，任务因而可以用数据描述，用于日志恢复、任务文件等无法保存函数本身的场景
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]*handlerSig
+}
+
+// 注册时解析的任务函数签名
+type handlerSig struct {
+	value   reflect.Value
+	withCtx bool           // 第一个形参是否为context.Context
+	in      []reflect.Type // 除ctx外的形参类型
+}
+
+// DefaultRegistry 默认的任务函数注册表，Async未通过SetRegistry设置注册表时使用
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry 创建任务函数注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[string]*handlerSig),
+	}
+}
+
+// Register 注册任务函数
+//
+// handler不是函数、除第一个context.Context外的形参无法由json反序列化或name已被注册时返回错误
+func (r *Registry) Register(name string, handler interface{}) error {
+	sig, err := newHandlerSig(handler)
+	if err != nil {
+		return fmt.Errorf("%s %v", name, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.handlers[name]; ok {
+		return fmt.Errorf("%s 已被注册", name)
+	}
+	r.handlers[name] = sig
+	return nil
+}
+
+// Register 向DefaultRegistry注册任务函数
+func Register(name string, handler interface{}) error {
+	return DefaultRegistry.Register(name, handler)
+}
+
+// Names 获取所有已注册的任务函数名
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 获取已注册的任务函数
+func (r *Registry) lookup(name string) (*handlerSig, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sig, ok := r.handlers[name]
+	if !ok {
+		return nil, fmt.Errorf("%s 未注册", name)
+	}
+	return sig, nil
+}
+
+func newHandlerSig(handler interface{}) (*handlerSig, error) {
+	handlerValue := reflect.ValueOf(handler)
+	if handlerValue.Kind() != reflect.Func {
+		return nil, fmt.Errorf("不是函数")
+	}
+	t := handlerValue.Type()
+	sig := &handlerSig{
+		value:   handlerValue,
+		withCtx: t.NumIn() > 0 && t.In(0) == contextType,
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && sig.withCtx {
+			continue
+		}
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+		if err := checkDecodable(in, make(map[reflect.Type]bool)); err != nil {
+			return nil, fmt.Errorf("第%d个形参%v", i, err)
+		}
+		sig.in = append(sig.in, t.In(i))
+	}
+	return sig, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// 检查类型能否由json反序列化
+func checkDecodable(t reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return fmt.Errorf("的类型%v无法由json反序列化", t)
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			return fmt.Errorf("的类型%v无法由json反序列化", t)
+		}
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return checkDecodable(t.Elem(), seen)
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			if !reflect.PtrTo(t.Key()).Implements(textUnmarshalerType) {
+				return fmt.Errorf("的类型%v无法由json反序列化", t)
+			}
+		}
+		return checkDecodable(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+				continue
+			}
+			if err := checkDecodable(f.Type, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 形参的个数与类型
+func (sig *handlerSig) paramType(k int) reflect.Type {
+	t := sig.value.Type()
+	if t.IsVariadic() && k >= len(sig.in)-1 {
+		return sig.in[len(sig.in)-1].Elem()
+	}
+	return sig.in[k]
+}
+
+// 检查实参的个数
+func (sig *handlerSig) checkArgNum(n int) error {
+	if sig.value.Type().IsVariadic() {
+		if n < len(sig.in)-1 {
+			return fmt.Errorf("形参与实参个数不同")
+		}
+		return nil
+	}
+	if n != len(sig.in) {
+		return fmt.Errorf("形参与实参个数不同")
+	}
+	return nil
+}
+
+// 检查实参的个数与类型
+func (sig *handlerSig) checkArgs(args []interface{}) error {
+	if err := sig.checkArgNum(len(args)); err != nil {
+		return err
+	}
+	for k, v := range args {
+		in := sig.paramType(k)
+		if v == nil {
+			switch in.Kind() {
+			case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+				continue
+			}
+		} else if reflect.TypeOf(v).AssignableTo(in) {
+			continue
+		}
+		return fmt.Errorf("形参与实参类型不同:%d", k)
+	}
+	return nil
+}
+
+// 按形参类型反序列化参数
+func (sig *handlerSig) decodeArgs(raw []json.RawMessage) ([]interface{}, error) {
+	if err := sig.checkArgNum(len(raw)); err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(raw))
+	for k, b := range raw {
+		v := reflect.New(sig.paramType(k))
+		if err := json.Unmarshal(b, v.Interface()); err != nil {
+			return nil, fmt.Errorf("第%d个参数无法反序列化: %v", k, err)
+		}
+		args[k] = v.Elem().Interface()
+	}
+	return args, nil
+}
+
+// SetRegistry 设置AddNamed、AddByName、ResumeFrom使用的任务函数注册表，默认为DefaultRegistry
+func (a *Async) SetRegistry(r *Registry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.registry = r
+}
+
+// 获取使用的任务函数注册表
+func (a *Async) getRegistry() *Registry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.registry == nil {
+		return DefaultRegistry
+	}
+	return a.registry
+}
+
+// AddNamed 通过注册表中的任务函数名添加异步执行任务,保存执行结果
+//
+// params 任务执行函数所需要的参数，需能被json序列化，其中的TaskOption会被作为任务选项；
+// 第一个形参为context.Context时不需要传入。
+// 通过AddNamed添加的任务会被写入SetJournal设置的日志中，可通过ResumeFrom恢复
+func (a *Async) AddNamed(taskName string, handlerName string, params ...interface{}) (task_name string, b_success bool, err error) {
+	sig, err := a.getRegistry().lookup(handlerName)
+	if err != nil {
+		return taskName, false, err
+	}
+	_, args := splitOptions(params)
+	if err = sig.checkArgs(args); err != nil {
+		return taskName, false, err
+	}
+	return a.addNamed(taskName, handlerName, sig, args, params)
+}
+
+// AddByName 通过注册表中的任务函数名添加异步执行任务,保存执行结果
+//
+// jsonArgs 任务执行函数所需要的参数组成的json数组，按形参类型反序列化，为空时表示没有参数；
+// 第一个形参为context.Context时不需要传入
+func (a *Async) AddByName(taskName string, handlerName string, jsonArgs []byte, opts ...TaskOption) (task_name string, b_success bool, err error) {
+	sig, err := a.getRegistry().lookup(handlerName)
+	if err != nil {
+		return taskName, false, err
+	}
+	var raw []json.RawMessage
+	if len(jsonArgs) > 0 {
+		if err = json.Unmarshal(jsonArgs, &raw); err != nil {
+			return taskName, false, fmt.Errorf("参数不是json数组: %v", err)
+		}
+	}
+	args, err := sig.decodeArgs(raw)
+	if err != nil {
+		return taskName, false, err
+	}
+	params := args
+	for _, o := range opts {
+		params = append(params, o)
+	}
+	return a.addNamed(taskName, handlerName, sig, args, params)
+}
+
+func (a *Async) addNamed(taskName string, handlerName string, sig *handlerSig, args []interface{}, params []interface{}) (task_name string, b_success bool, err error) {
+	task, err := a.newTask(taskName, sig.value.Interface(), nil, true, params...)
+	if err != nil {
+		return task.name, false, err
+	}
+	if task.named, err = newNamedTask(handlerName, args); err != nil {
+		return task.name, false, err
+	}
+	task.withCtx = sig.withCtx
+	if err = a.insertTask(task); err != nil {
+		return task.name, false, err
+	}
+	return task.name, true, nil
+}
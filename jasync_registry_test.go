@@ -0,0 +1,75 @@
+package jasync
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+type probeArgs struct {
+	Host  string
+	Ports []int
+}
+
+func TestRegistry_AddByName(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register("bad", func(ch chan int) {}); err == nil {
+		t.Fatal("chan param")
+	}
+	if err := r.Register("bad", func(s struct{ F func() }) {}); err == nil {
+		t.Fatal("func field")
+	}
+	if err := r.Register("probe", func(ctx context.Context, args probeArgs, timeout int) (string, error) {
+		if ctx == nil {
+			t.Error("ctx not injected")
+		}
+		return fmt.Sprintf("%s:%v:%d", args.Host, args.Ports, timeout), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("sum", func(base int, ns ...int) int {
+		for _, n := range ns {
+			base += n
+		}
+		return base
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if names := r.Names(); len(names) != 2 || names[0] != "probe" || names[1] != "sum" {
+		t.Fatalf("names: %v", names)
+	}
+
+	a := New(false)
+	a.SetRegistry(r)
+	if _, ok, err := a.AddByName("p1", "probe", []byte(`[{"Host":"10.0.0.1","Ports":[80,443]},3]`), WithTimeout(0)); !ok {
+		t.Fatal(err)
+	}
+	if _, ok, err := a.AddByName("s1", "sum", []byte(`[1,2,3]`)); !ok {
+		t.Fatal(err)
+	}
+	if _, ok, err := a.AddByName("s2", "sum", []byte(`[1]`)); !ok {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ handler, args string }{
+		{"probe", `[{"Host":"h"}]`},
+		{"probe", `[{"Host":1},3]`},
+		{"probe", `{"Host":"h"}`},
+		{"sum", ``},
+		{"none", `[]`},
+	} {
+		if _, ok, _ := a.AddByName("", c.handler, []byte(c.args)); ok {
+			t.Fatalf("%s %s", c.handler, c.args)
+		}
+	}
+	if _, ok, _ := a.AddNamed("", "sum", "1"); ok {
+		t.Fatal("wrong arg type")
+	}
+	a.Run(2)
+	a.Wait()
+	if r := a.GetTaskResult("p1"); len(r) != 2 || r[0] != "10.0.0.1:[80 443]:3" {
+		t.Fatalf("p1: %v %v", r, a.GetTaskError("p1"))
+	}
+	if a.GetTaskResult("s1")[0] != 6 || a.GetTaskResult("s2")[0] != 1 {
+		t.Fatalf("sum: %v %v", a.GetTaskResult("s1"), a.GetTaskResult("s2"))
+	}
+}
@@ -0,0 +1,238 @@
+package jasync
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Resources 各种资源的数量，如Resources{"cpu": 2, "mem": 512 << 20, "conns": 1}
+type Resources map[string]int64
+
+// WithResources 设置任务对各种资源的需求，需通过SetResources设置资源的容量
+//
+// 各项需求都能满足时任务才开始执行；需求超过容量的任务无法执行：Async中该任务被置为STATUS_FAIL，AsyncRealtime中返回错误
+func WithResources(demand Resources) TaskOption {
+	return func(o *taskOption) {
+		o.demand = make(Resources, len(demand))
+		for k, v := range demand {
+			o.demand[k] = v
+		}
+	}
+}
+
+// MultiWeighted 多种资源的信号量，各项需求都能满足时才放行，可同时用于多个Async、AsyncRealtime
+//
+// 与Weighted相同，按先进先出的顺序放行等待者，需求大的等待者不会被需求小的等待者插队而饥饿
+type MultiWeighted struct {
+	size    Resources
+	mu      sync.Mutex
+	cur     Resources
+	waiters list.List
+}
+
+type resourceWaiter struct {
+	n     Resources
+	ready chan<- struct{} // 获取成功后关闭
+}
+
+// NewMultiWeighted 创建多种资源的信号量，size为各种资源的容量
+func NewMultiWeighted(size Resources) *MultiWeighted {
+	s := &MultiWeighted{size: make(Resources, len(size)), cur: make(Resources, len(size))}
+	for k, v := range size {
+		s.size[k] = v
+	}
+	return s
+}
+
+// 检查需求是否超过容量，未设置容量的资源的容量为0
+func (s *MultiWeighted) check(n Resources) error {
+	for k, v := range n {
+		if v < 0 {
+			return fmt.Errorf("资源%s的需求%d小于0", k, v)
+		}
+		if v > s.size[k] {
+			return fmt.Errorf("资源%s的需求%d超过容量%d", k, v, s.size[k])
+		}
+	}
+	return nil
+}
+
+// 剩余的资源是否满足需求，需持有锁
+func (s *MultiWeighted) fits(n Resources) bool {
+	for k, v := range n {
+		if s.size[k]-s.cur[k] < v {
+			return false
+		}
+	}
+	return true
+}
+
+// 占用或释放资源，需持有锁
+func (s *MultiWeighted) add(n Resources, sign int64) {
+	for k, v := range n {
+		s.cur[k] += sign * v
+	}
+}
+
+// Acquire 获取资源，直到各项需求都能满足或ctx被取消
+//
+// 需求超过容量时直接返回错误；ctx被取消时返回ctx.Err()，且不占用资源
+func (s *MultiWeighted) Acquire(ctx context.Context, n Resources) error {
+	if len(n) == 0 {
+		return nil
+	}
+	if err := s.check(n); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.waiters.Len() == 0 && s.fits(n) {
+		s.add(n, 1)
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(resourceWaiter{n: n, ready: ready})
+	s.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// 取消的同时已获取成功，视为获取成功
+			err = nil
+		default:
+			isFront := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			// 位于队首的等待者被移除后，其后的等待者可能已经可以获取
+			if isFront {
+				s.notifyWaiters()
+			}
+		}
+		s.mu.Unlock()
+		return err
+	case <-ready:
+		return nil
+	}
+}
+
+// TryAcquire 不阻塞地获取资源，成功时返回true
+func (s *MultiWeighted) TryAcquire(n Resources) bool {
+	if len(n) == 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.waiters.Len() > 0 || s.check(n) != nil || !s.fits(n) {
+		return false
+	}
+	s.add(n, 1)
+	return true
+}
+
+// Release 释放资源
+func (s *MultiWeighted) Release(n Resources) {
+	if len(n) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(n, -1)
+	for k, v := range s.cur {
+		if v < 0 {
+			panic(fmt.Sprintf("semaphore: 资源%s释放的数量超过占用的数量", k))
+		}
+	}
+	s.notifyWaiters()
+}
+
+// GetCur 获取已占用的各种资源的数量
+func (s *MultiWeighted) GetCur() Resources {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur := make(Resources, len(s.cur))
+	for k, v := range s.cur {
+		cur[k] = v
+	}
+	return cur
+}
+
+// 按先进先出的顺序放行等待者，需持有锁
+//
+// 队首的等待者无法满足时，即使其后的等待者可以满足也不放行，避免需求大的等待者饥饿
+func (s *MultiWeighted) notifyWaiters() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			break
+		}
+		w := next.Value.(resourceWaiter)
+		if !s.fits(w.n) {
+			break
+		}
+		s.add(w.n, 1)
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
+
+// 进度信息中输出的各种资源的占用情况
+func (s *MultiWeighted) progress() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.size))
+	for k := range s.size {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&b, " %s:%d/%d", k, s.cur[k], s.size[k])
+	}
+	return b.String()
+}
+
+// SetResources 设置任务通过WithResources声明的资源需求所使用的信号量，需在Run前调用
+func (a *Async) SetResources(s *MultiWeighted) {
+	a.resources = s
+}
+
+// SetResources 设置任务通过WithResources声明的资源需求所使用的信号量，需在添加任务前调用
+func (ar *AsyncRealtime) SetResources(s *MultiWeighted) {
+	ar.resources = s
+}
+
+// 检查任务的资源需求是否超过容量，未设置信号量时不检查
+func checkResources(s *MultiWeighted, taskName string, demand Resources) error {
+	if s == nil || len(demand) == 0 {
+		return nil
+	}
+	if err := s.check(demand); err != nil {
+		return fmt.Errorf("任务%s: %v", taskName, err)
+	}
+	return nil
+}
+
+// 获取任务需要的资源，未设置信号量时直接返回
+func acquireResources(ctx context.Context, s *MultiWeighted, demand Resources) error {
+	if s == nil {
+		return nil
+	}
+	return s.Acquire(ctx, demand)
+}
+
+// 释放任务占用的资源，未设置信号量时直接返回
+func releaseResources(s *MultiWeighted, demand Resources) {
+	if s == nil {
+		return
+	}
+	s.Release(demand)
+}
@@ -0,0 +1,120 @@
+package jasync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func acquireResourcesAsync(s *MultiWeighted, n Resources) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		if s.Acquire(context.Background(), n) == nil {
+			close(done)
+		}
+	}()
+	return done
+}
+
+func TestMultiWeighted(t *testing.T) {
+	s := NewMultiWeighted(Resources{"cpu": 4, "mem": 4})
+	if err := s.Acquire(context.Background(), Resources{"conns": 1}); err == nil {
+		t.Fatal("demand beyond capacity should fail")
+	}
+	s.Acquire(context.Background(), Resources{"cpu": 3, "mem": 1})
+	big := acquireResourcesAsync(s, Resources{"cpu": 2, "mem": 3})
+	time.Sleep(10 * time.Millisecond)
+	// 可以满足的等待者不能插队到无法满足的等待者之前
+	small := acquireResourcesAsync(s, Resources{"cpu": 1})
+	if isDone(big) || isDone(small) || s.TryAcquire(Resources{"mem": 1}) {
+		t.Fatal("acquired out of order")
+	}
+	// 等待期间ctx被取消时返回ctx.Err()，且不占用资源
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := s.Acquire(ctx, Resources{"mem": 4}); err != context.Canceled {
+		t.Fatalf("canceled acquire: %v", err)
+	}
+	s.Release(Resources{"cpu": 3, "mem": 1})
+	if !isDone(big) || !isDone(small) {
+		t.Fatal("waiters not woken")
+	}
+	if cur := s.GetCur(); cur["cpu"] != 3 || cur["mem"] != 3 {
+		t.Fatalf("cur: %v", cur)
+	}
+}
+
+// 记录同时执行的任务占用的各种资源之和的最大值
+type resourceCounter struct {
+	mu   sync.Mutex
+	cur  Resources
+	max  Resources
+	runs int
+}
+
+func newResourceCounter() *resourceCounter {
+	return &resourceCounter{cur: make(Resources), max: make(Resources)}
+}
+
+func (c *resourceCounter) run(n Resources) {
+	c.mu.Lock()
+	c.runs++
+	for k, v := range n {
+		c.cur[k] += v
+		if c.cur[k] > c.max[k] {
+			c.max[k] = c.cur[k]
+		}
+	}
+	c.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	for k, v := range n {
+		c.cur[k] -= v
+	}
+	c.mu.Unlock()
+}
+
+func TestAsync_WithResources(t *testing.T) {
+	a := New(false)
+	res := NewMultiWeighted(Resources{"cpu": 4, "mem": 2})
+	a.SetResources(res)
+	c := newResourceCounter()
+	for _, n := range []Resources{{"cpu": 3}, {"cpu": 1, "mem": 1}, {"mem": 2}, {"cpu": 2, "mem": 1}, {"cpu": 2}} {
+		n := n
+		a.Add("", func() { c.run(n) }, nil, WithResources(n))
+	}
+	a.Add("big", func() {}, nil, WithResources(Resources{"mem": 3}))
+	a.Run(10)
+	a.Wait()
+	if c.runs != 5 || c.max["cpu"] != 4 || c.max["mem"] != 2 {
+		t.Fatalf("runs %d max %v", c.runs, c.max)
+	}
+	if s := a.GetTaskStatus("big"); s != STATUS_FAIL {
+		t.Fatalf("big status: %d", s)
+	}
+	// Wait返回时任务已释放占用的资源
+	if cur := res.GetCur(); cur["cpu"] != 0 || cur["mem"] != 0 {
+		t.Fatalf("cur after Wait: %v", cur)
+	}
+}
+
+func TestAsyncRealtime_WithResources(t *testing.T) {
+	ar := NewAR(10, false)
+	ar.SetResources(NewMultiWeighted(Resources{"cpu": 4, "mem": 2}))
+	if _, _, err := ar.AddAndRun("big", func() {}, nil, WithResources(Resources{"gpu": 1})); err == nil {
+		t.Fatal("demand beyond capacity should fail")
+	}
+	c := newResourceCounter()
+	for _, n := range []Resources{{"cpu": 3}, {"cpu": 1, "mem": 1}, {"mem": 2}, {"cpu": 2, "mem": 1}} {
+		n := n
+		ar.Init("").CAdd(func() { c.run(n) }).COpt(WithResources(n)).CDO()
+	}
+	ar.Wait()
+	if c.runs != 4 || c.max["cpu"] != 4 || c.max["mem"] != 2 {
+		t.Fatalf("runs %d max %v", c.runs, c.max)
+	}
+}
@@ -0,0 +1,90 @@
+package jasync
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 任务失败时的重试策略
+//
+// 第n次重试前等待 BaseDelay*2^(n-1)，不超过MaxDelay；等待期间释放任务占用的并发数
+type RetryPolicy struct {
+	MaxAttempts int           // 最多执行次数(含第一次)，<=1表示不重试
+	BaseDelay   time.Duration // 第一次重试前的等待时间
+	MaxDelay    time.Duration // 等待时间上限，<=0表示不限制
+	// 随机抖动比例，取值[0,1]，实际等待时间在 delay*(1-Jitter) 到 delay 之间
+	Jitter float64
+	// 判断错误是否可以重试，为nil时除context.Canceled外的错误都会重试
+	Retryable func(err error) bool
+}
+
+// WithRetry 设置任务失败(STATUS_FAIL、STATUS_TIMEOUT)时的重试策略
+func WithRetry(p RetryPolicy) TaskOption {
+	return func(o *taskOption) {
+		o.retry = &p
+	}
+}
+
+// 第attempt次执行失败后，下次执行前需要等待的时间
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+		// 不限制等待时间时，避免翻倍后溢出
+		if delay > math.MaxInt64/2 {
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 && delay > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay -= time.Duration(rand.Float64() * jitter * float64(delay))
+	}
+	return delay
+}
+
+// 第attempt次执行失败后是否还需要重试
+func (p *RetryPolicy) shouldRetry(attempt int, status int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts || !isFailed(status) {
+		return false
+	}
+	if p.Retryable == nil {
+		return err != context.Canceled
+	}
+	return p.Retryable(err)
+}
+
+// 按重试策略执行fn，fn返回STATUS_DONE或不需要重试时返回fn最后一次的结果
+//
+// 每次重试前调用release释放占用的并发数，等待结束后调用acquire重新获取；
+// 等待或获取期间ctx被取消时不再重试，held返回false，表示并发数已被释放
+func retryRun(ctx context.Context, p *RetryPolicy, fn func(attempt int) (int, error), release func(), acquire func(ctx context.Context) error) (status int, held bool, err error) {
+	for attempt := 1; ; attempt++ {
+		status, err = fn(attempt)
+		if !p.shouldRetry(attempt, status, err) {
+			return status, true, err
+		}
+		release()
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return status, false, err
+		}
+		if acquire(ctx) != nil {
+			return status, false, err
+		}
+	}
+}
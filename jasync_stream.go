@@ -0,0 +1,97 @@
+package jasync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TaskResult 任务的执行结果
+type TaskResult struct {
+	Name    string
+	Status  int           // 任务状态，STATUS_DONE、STATUS_FAIL等
+	Values  []interface{} // 任务函数的返回值，超时、panic、取消时为nil
+	Err     error         // 任务未正常结束的原因
+	BegTime time.Time     // 任务开始时间，未派发的任务为零值
+	EndTime time.Time     // 任务结束时间
+}
+
+// Duration 任务执行耗时
+func (r TaskResult) Duration() time.Duration {
+	if r.BegTime.IsZero() {
+		return 0
+	}
+	return r.EndTime.Sub(r.BegTime)
+}
+
+// 一次RunStream对应的结果channel
+type resultStream struct {
+	ch chan TaskResult
+	wg sync.WaitGroup
+}
+
+// RunStream 同RunContext，任务的派发在后台进行，并返回一个接收任务执行结果的channel
+//
+// 每个任务结束(包括失败、超时、取消)时立即发送其结果，本次派发的所有任务结束后channel被关闭。
+// 无论是否通过AddR添加，结果中均包含任务函数的返回值
+func (a *Async) RunStream(ctx context.Context, taskParaCountMaxLimit int) (<-chan TaskResult, error) {
+	if a.taskCurNeedDoCount < 1 {
+		return nil, fmt.Errorf("没有需要执行的任务")
+	}
+	a.mu.Lock()
+	// 在后台派发前检查依赖关系，出错时直接返回，未派发的任务置为取消状态
+	if err := a.checkDeps(); err != nil {
+		a.mu.Unlock()
+		a.cancelPending(err)
+		a.fireHooks()
+		return nil, err
+	}
+	pending := make([]*asyncTask, 0, a.taskCurNeedDoCount)
+	for _, v := range a.order {
+		if isPending(v.TaskStatus.taskStatus) {
+			pending = append(pending, v)
+		}
+	}
+	// channel的容量与任务数相同，任务结束时发送结果不会阻塞
+	s := &resultStream{ch: make(chan TaskResult, len(pending))}
+	s.wg.Add(len(pending))
+	for _, v := range pending {
+		v.stream = s
+	}
+	a.mu.Unlock()
+	go func() {
+		s.wg.Wait()
+		close(s.ch)
+	}()
+	// RunContext出错时会取消所有未派发的任务，channel同样会被关闭
+	go a.RunContext(ctx, taskParaCountMaxLimit)
+	return s.ch, nil
+}
+
+// 根据任务状态生成任务的执行结果，需持有锁
+func (task *asyncTask) result(values []interface{}) TaskResult {
+	r := TaskResult{
+		Name:   task.name,
+		Status: task.TaskStatus.taskStatus,
+		Values: values,
+		Err:    task.TaskStatus.taskErr,
+	}
+	if task.TaskStatus.taskBegTime != 0 {
+		r.BegTime = time.Unix(0, task.TaskStatus.taskBegTime)
+	}
+	if task.TaskStatus.taskEndTime != 0 {
+		r.EndTime = time.Unix(0, task.TaskStatus.taskEndTime)
+	}
+	return r
+}
+
+// 任务结束时将结果发送到RunStream返回的channel中，需持有写锁
+func (a *Async) emitResult(task *asyncTask, values []interface{}) {
+	if task.stream == nil {
+		return
+	}
+	task.stream.ch <- task.result(values)
+	task.stream.wg.Done()
+	task.stream = nil
+}
@@ -0,0 +1,76 @@
+package jasync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAsync_RunStream(t *testing.T) {
+	a := New(false)
+	for i := 0; i < 5; i++ {
+		i := i
+		a.Add("t"+strconv.Itoa(i), func() (int, error) {
+			time.Sleep(time.Duration(5-i) * 20 * time.Millisecond)
+			if i == 2 {
+				return i, fmt.Errorf("t2 failed")
+			}
+			return i, nil
+		}, nil)
+	}
+	ch, err := a.RunStream(context.Background(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for r := range ch {
+		names = append(names, r.Name)
+		if len(r.Values) != 2 || r.Values[0] != int(r.Name[1]-'0') || r.Duration() <= 0 {
+			t.Fatalf("%s: %v,%v", r.Name, r.Values, r.Duration())
+		}
+		if (r.Name == "t2") != (r.Status == STATUS_FAIL && r.Err != nil) {
+			t.Fatalf("%s: %d,%v", r.Name, r.Status, r.Err)
+		}
+	}
+	// 先结束的任务先收到结果
+	if fmt.Sprint(names) != "[t4 t3 t2 t1 t0]" {
+		t.Fatalf("order: %v", names)
+	}
+	a.Wait()
+	if _, err = a.RunStream(context.Background(), 5); err == nil {
+		t.Fatal("no task to run")
+	}
+}
+
+func TestAsync_RunStreamError(t *testing.T) {
+	a := New(false)
+	a.Add("t1", func() {}, nil, After("t2"))
+	a.Add("t2", func() {}, nil, After("t1"))
+	if _, err := a.RunStream(context.Background(), 1); err == nil {
+		t.Fatal("cycle should fail")
+	}
+	a.Wait()
+	// 派发期间出错时，未派发的任务被取消，channel被关闭
+	a = New(false)
+	a.Add("t1", func() {}, nil)
+	a.Add("t2", func() {}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ch, err := a.RunStream(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for r := range ch {
+		if r.Status != STATUS_CANCEL {
+			t.Fatalf("%s status: %d", r.Name, r.Status)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("results: %d", n)
+	}
+	a.Wait()
+}
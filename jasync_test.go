@@ -1,8 +1,13 @@
 package jasync
 
 import (
+	"context"
+	"fmt"
 	"github.com/chroblert/jlog"
+	"math"
+	"runtime/metrics"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -42,3 +47,278 @@ func TestMain2(t *testing.T) {
 	a.PrintTaskStatus("t12", true)
 	jlog.Debug("kkkkkkkjkj")
 }
+
+func TestAsync_RunContext(t *testing.T) {
+	a := New(false)
+	for i := 0; i < 10; i++ {
+		a.AddR("t"+strconv.Itoa(i), func() {
+			time.Sleep(100 * time.Millisecond)
+		}, nil)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if ok, err := a.RunContext(ctx, 1); ok || err == nil {
+		t.Fatalf("RunContext: %v,%v", ok, err)
+	}
+	a.Wait()
+	canceled := 0
+	for i := 0; i < 10; i++ {
+		if a.GetTaskStatus("t"+strconv.Itoa(i)) == STATUS_CANCEL {
+			canceled++
+		}
+	}
+	if canceled == 0 || canceled == 10 {
+		t.Fatalf("canceled: %d", canceled)
+	}
+}
+
+func TestAsync_WithTimeout(t *testing.T) {
+	a := New(false)
+	a.AddR("t1", func(ctx context.Context, s string) string {
+		<-ctx.Done()
+		return s
+	}, nil, WithTimeout(50*time.Millisecond), "t1")
+	a.AddR("t2", func() {
+		time.Sleep(time.Second)
+	}, nil, WithTimeout(50*time.Millisecond))
+	a.AddR("t3", func(s string) string {
+		return s
+	}, nil, "t3", WithTimeout(time.Second))
+	a.Run(1)
+	a.Wait()
+	for k, v := range map[string]int{"t1": STATUS_TIMEOUT, "t2": STATUS_TIMEOUT, "t3": STATUS_DONE} {
+		if a.GetTaskStatus(k) != v {
+			t.Fatalf("%s status: %d", k, a.GetTaskStatus(k))
+		}
+	}
+	if r := a.GetTaskResult("t3"); len(r) != 1 || r[0] != "t3" {
+		t.Fatalf("t3 result: %v", r)
+	}
+}
+
+func TestAsync_Panic(t *testing.T) {
+	a := New(false)
+	a.AddR("t1", func() int {
+		panic("t1")
+	}, nil)
+	a.AddR("t2", func() int {
+		return 2
+	}, func(i int) {
+		panic("t2")
+	})
+	a.AddR("t3", func() int {
+		return 3
+	}, nil)
+	a.Run(2)
+	a.Wait()
+	for _, k := range []string{"t1", "t2"} {
+		if a.GetTaskStatus(k) != STATUS_FAIL {
+			t.Fatalf("%s status: %d", k, a.GetTaskStatus(k))
+		}
+		if pe, ok := a.GetTaskError(k).(*PanicError); !ok || pe.Value != k || len(pe.Stack) == 0 {
+			t.Fatalf("%s error: %v", k, a.GetTaskError(k))
+		}
+	}
+	if a.GetTaskStatus("t3") != STATUS_DONE || a.GetTaskError("t3") != nil {
+		t.Fatalf("t3 status: %d", a.GetTaskStatus("t3"))
+	}
+}
+
+func TestAsync_TaskErrors(t *testing.T) {
+	a := New(false)
+	fail := true
+	for i := 0; i < 4; i++ {
+		i := i
+		a.AddR("t"+strconv.Itoa(i), func() (int, error) {
+			if i%2 == 1 && fail {
+				return 0, fmt.Errorf("t%d failed", i)
+			}
+			return i, nil
+		}, nil)
+	}
+	a.Run(2)
+	a.Wait()
+	if failed := a.FailedTasks(); len(failed) != 2 || failed[0] != "t1" || failed[1] != "t3" {
+		t.Fatalf("FailedTasks: %v", failed)
+	}
+	if errs := a.GetTaskErrors(); len(errs) != 2 || errs["t1"].Error() != "t1 failed" {
+		t.Fatalf("GetTaskErrors: %v", errs)
+	}
+	if r := a.GetTaskResult("t3"); len(r) != 2 || r[1] == nil {
+		t.Fatalf("t3 result: %v", r)
+	}
+	// 重新执行失败的任务
+	fail = false
+	a.ResetTasks(a.FailedTasks()...)
+	a.Run(2)
+	a.Wait()
+	if failed := a.FailedTasks(); len(failed) != 0 {
+		t.Fatalf("FailedTasks: %v", failed)
+	}
+	if r := a.GetTaskResult("t3"); len(r) != 2 || r[0] != 3 || r[1] != nil {
+		t.Fatalf("t3 result: %v", r)
+	}
+}
+
+func TestAsync_WithRetry(t *testing.T) {
+	a := New(false)
+	var n1, n2 int32
+	retry := RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 20 * time.Millisecond, Jitter: 0.5}
+	a.AddR("t1", func() (int32, error) {
+		if n := atomic.AddInt32(&n1, 1); n < 3 {
+			return n, fmt.Errorf("attempt %d", n)
+		}
+		return n1, nil
+	}, nil, WithRetry(retry))
+	a.AddR("t2", func() error {
+		atomic.AddInt32(&n2, 1)
+		return fmt.Errorf("not retryable")
+	}, nil, WithRetry(RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool {
+		return err.Error() != "not retryable"
+	}}))
+	a.Run(1)
+	a.Wait()
+	a.PrintAllTaskStatus(true)
+	if a.GetTaskStatus("t1") != STATUS_DONE || n1 != 3 {
+		t.Fatalf("t1 status: %d,attempts: %d", a.GetTaskStatus("t1"), n1)
+	}
+	if a.GetTaskStatus("t2") != STATUS_FAIL || n2 != 1 {
+		t.Fatalf("t2 status: %d,attempts: %d", a.GetTaskStatus("t2"), n2)
+	}
+}
+
+// 10万个任务，最多100个同时执行；cpu-ms/op为执行期间进程消耗的CPU时间
+func BenchmarkAsync_Run100k(b *testing.B) {
+	sample := []metrics.Sample{{Name: "/cpu/classes/user:cpu-seconds"}}
+	cpuSeconds := func() float64 {
+		metrics.Read(sample)
+		if sample[0].Value.Kind() != metrics.KindFloat64 {
+			return 0
+		}
+		return sample[0].Value.Float64()
+	}
+	var cpu float64
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		a := New(false)
+		for j := 0; j < 100000; j++ {
+			a.Add("", func() {
+				time.Sleep(time.Millisecond)
+			}, nil)
+		}
+		beg := cpuSeconds()
+		b.StartTimer()
+		a.Run(100)
+		a.Wait()
+		b.StopTimer()
+		cpu += cpuSeconds() - beg
+	}
+	b.ReportMetric(cpu*1000/float64(b.N), "cpu-ms/op")
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: time.Second}
+	if d := p.backoff(3); d != 4*time.Second {
+		t.Fatalf("backoff(3): %v", d)
+	}
+	// 不限制等待时间时，翻倍不会溢出为负数或0
+	for _, attempt := range []int{40, 64, 100} {
+		if d := p.backoff(attempt); d != math.MaxInt64 {
+			t.Fatalf("backoff(%d): %v", attempt, d)
+		}
+	}
+	p.MaxDelay = time.Minute
+	if d := p.backoff(100); d != time.Minute {
+		t.Fatalf("backoff with MaxDelay: %v", d)
+	}
+}
+
+func TestAsync_DispatchOrder(t *testing.T) {
+	for _, order := range []int{ORDER_FIFO, ORDER_LIFO} {
+		a := New(false)
+		a.SetDispatchOrder(order)
+		started := make([]string, 0)
+		for i := 0; i < 10; i++ {
+			name := "t" + strconv.Itoa(i)
+			a.AddR(name, func() string {
+				started = append(started, name)
+				return name
+			}, nil)
+		}
+		a.Run(1)
+		a.Wait()
+		for i, name := range started {
+			want := i
+			if order == ORDER_LIFO {
+				want = 9 - i
+			}
+			if name != "t"+strconv.Itoa(want) {
+				t.Fatalf("order %d: %v", order, started)
+			}
+		}
+		// 结果按添加顺序返回
+		results := a.GetTasksResultList()
+		if len(results) != 10 {
+			t.Fatalf("results: %v", results)
+		}
+		for i, r := range results {
+			if r.Name != "t"+strconv.Itoa(i) || r.Values[0] != r.Name || r.Status != STATUS_DONE {
+				t.Fatalf("results: %v", results)
+			}
+		}
+	}
+}
+
+func TestAsync_WithPriority(t *testing.T) {
+	a := New(false)
+	started := make([]string, 0)
+	for i, p := range []int{0, 1, 0, 5, 1} {
+		name := "t" + strconv.Itoa(i)
+		a.Add(name, func() {
+			started = append(started, name)
+		}, nil, WithPriority(p))
+	}
+	a.Run(1)
+	a.Wait()
+	if fmt.Sprint(started) != "[t3 t1 t4 t0 t2]" {
+		t.Fatalf("order: %v", started)
+	}
+}
+
+func TestTaskQueue_Aging(t *testing.T) {
+	q := newTaskQueue(time.Second, false)
+	low := &asyncTask{name: "low", opt: &taskOption{priority: 0}}
+	high := &asyncTask{name: "high", opt: &taskOption{priority: 1}}
+	// low已等待2s，有效优先级为2，高于刚入队的high
+	q.push(low, q.base)
+	q.push(high, q.base+int64(2*time.Second))
+	if r := q.pop(); r != low {
+		t.Fatalf("pop: %s", r.name)
+	}
+	// 同一aging时段内入队的任务按LIFO出队，较早时段入队的任务先出队
+	q = newTaskQueue(time.Second, true)
+	t1 := &asyncTask{name: "t1", opt: &taskOption{}}
+	t2 := &asyncTask{name: "t2", opt: &taskOption{}}
+	t3 := &asyncTask{name: "t3", opt: &taskOption{}}
+	q.push(t1, q.base)
+	q.push(t2, q.base+int64(100*time.Millisecond))
+	q.push(t3, q.base+int64(1500*time.Millisecond))
+	if r1, r2, r3 := q.pop(), q.pop(), q.pop(); r1 != t2 || r2 != t1 || r3 != t3 {
+		t.Fatalf("pop: %s %s %s", r1.name, r2.name, r3.name)
+	}
+	// 优先级很大时不会溢出
+	q = newTaskQueue(time.Hour, false)
+	max := &asyncTask{name: "max", opt: &taskOption{priority: math.MaxInt32}}
+	q.push(low, q.base)
+	q.push(max, q.base+int64(2*time.Hour))
+	if r := q.pop(); r != max {
+		t.Fatalf("pop: %s", r.name)
+	}
+	// 不老化时按优先级出队
+	q = newTaskQueue(0, false)
+	q.push(low, q.base)
+	q.push(high, q.base+int64(2*time.Second))
+	if r := q.pop(); r != high {
+		t.Fatalf("pop: %s", r.name)
+	}
+}
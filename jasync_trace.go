@@ -0,0 +1,190 @@
+package jasync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tracer 创建span的追踪器，形式与OpenTelemetry的trace.Tracer一致，可通过适配器接入
+//
+// 任务进入STATUS_DOING时创建span，任务结束时结束span；任务链中的每个函数创建子span
+type Tracer interface {
+	// Start 创建span，返回携带该span的ctx，任务函数接收的ctx由其派生
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span 追踪的一段执行过程
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute span的属性
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// 任务开始执行时创建span，并将等待信号量的时间作为事件记录
+func startSpan(tracer Tracer, ctx context.Context, taskName string, opt *taskOption, wait time.Duration) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := tracer.Start(ctx, taskName)
+	span.SetAttributes(Attribute{"jasync.task", taskName})
+	if opt.group != "" {
+		span.SetAttributes(Attribute{"jasync.group", opt.group})
+	}
+	if opt.key != "" {
+		span.SetAttributes(Attribute{"jasync.key", opt.key})
+	}
+	span.AddEvent("semaphore.acquired", Attribute{"jasync.wait", wait})
+	return ctx, span
+}
+
+// 任务结束时记录状态与错误并结束span，span可为nil
+func endSpan(span Span, status int, err error) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(Attribute{"jasync.status", status})
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// MemoryTracer 将span记录在内存中的Tracer，用于测试中检查任务的执行时间线
+type MemoryTracer struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+// SpanData MemoryTracer记录的span
+type SpanData struct {
+	ID         int
+	ParentID   int // 父span的ID，为0表示没有父span
+	Name       string
+	Start      time.Time
+	End        time.Time // 未结束时为零值
+	Attributes map[string]interface{}
+	Events     []SpanEvent
+	Errors     []error
+}
+
+// SpanEvent span中的事件
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
+// ctx中存放memorySpan的key
+type memorySpanKey struct{}
+
+type memorySpan struct {
+	t    *MemoryTracer
+	data *SpanData
+}
+
+// NewMemoryTracer 创建一个MemoryTracer
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{}
+}
+
+// Start 创建span，ctx中已有MemoryTracer创建的span时作为其子span
+func (t *MemoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data := &SpanData{ID: len(t.spans) + 1, Name: name, Start: time.Now(), Attributes: make(map[string]interface{})}
+	if parent, ok := ctx.Value(memorySpanKey{}).(*memorySpan); ok {
+		data.ParentID = parent.data.ID
+	}
+	t.spans = append(t.spans, data)
+	span := &memorySpan{t: t, data: data}
+	return context.WithValue(ctx, memorySpanKey{}, span), span
+}
+
+// Spans 按创建顺序返回已记录的span的副本
+func (t *MemoryTracer) Spans() []SpanData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := make([]SpanData, len(t.spans))
+	for k, data := range t.spans {
+		spans[k] = *data
+		spans[k].Attributes = make(map[string]interface{}, len(data.Attributes))
+		for key, v := range data.Attributes {
+			spans[k].Attributes[key] = v
+		}
+		spans[k].Events = append([]SpanEvent(nil), data.Events...)
+		spans[k].Errors = append([]error(nil), data.Errors...)
+	}
+	return spans
+}
+
+// Reset 清空已记录的span
+func (t *MemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+func (s *memorySpan) SetAttributes(attrs ...Attribute) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *memorySpan) AddEvent(name string, attrs ...Attribute) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	e := SpanEvent{Name: name, Time: time.Now(), Attributes: make(map[string]interface{}, len(attrs))}
+	for _, attr := range attrs {
+		e.Attributes[attr.Key] = attr.Value
+	}
+	s.data.Events = append(s.data.Events, e)
+}
+
+func (s *memorySpan) RecordError(err error) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.data.Errors = append(s.data.Errors, err)
+}
+
+// End 结束span，重复调用时只记录第一次的时间
+func (s *memorySpan) End() {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	if s.data.End.IsZero() {
+		s.data.End = time.Now()
+	}
+}
+
+// Duration span的持续时间，未结束时为0
+func (d SpanData) Duration() time.Duration {
+	if d.End.IsZero() {
+		return 0
+	}
+	return d.End.Sub(d.Start)
+}
+
+// String 输出span的名称与父子关系，便于在测试中比较
+func (d SpanData) String() string {
+	return fmt.Sprintf("%d:%s<-%d", d.ID, d.Name, d.ParentID)
+}
+
+// SetTracer 设置追踪任务执行的Tracer，需在添加任务前调用
+func (a *Async) SetTracer(tracer Tracer) {
+	a.tracer = tracer
+}
+
+// SetTracer 设置追踪任务执行的Tracer，需在添加任务前调用
+func (ar *AsyncRealtime) SetTracer(tracer Tracer) {
+	ar.tracer = tracer
+}
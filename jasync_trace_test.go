@@ -0,0 +1,72 @@
+package jasync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsync_Tracer(t *testing.T) {
+	tracer := NewMemoryTracer()
+	a := New(false)
+	a.SetTracer(tracer)
+	a.Add("t1", func(ctx context.Context) {
+		// 任务函数中创建的span为任务span的子span
+		_, span := tracer.Start(ctx, "inner")
+		span.End()
+	}, nil)
+	a.Add("t2", func() error { return errors.New("t2 failed") }, nil)
+	a.Run(1)
+	a.Wait()
+	spans := tracer.Spans()
+	got := make([]string, len(spans))
+	for k, s := range spans {
+		got[k] = s.String()
+		if s.End.IsZero() {
+			t.Fatalf("span %s not ended", s)
+		}
+	}
+	if strings.Join(got, " ") != "1:t1<-0 2:inner<-1 3:t2<-0" {
+		t.Fatalf("spans: %v", got)
+	}
+	if spans[2].Attributes["jasync.status"] != STATUS_FAIL || len(spans[2].Errors) != 1 {
+		t.Fatalf("t2 span: %+v", spans[2])
+	}
+	if e := spans[0].Events; len(e) != 1 || e[0].Name != "semaphore.acquired" {
+		t.Fatalf("t1 events: %+v", e)
+	}
+}
+
+func TestAsync_ARTracer(t *testing.T) {
+	tracer := NewMemoryTracer()
+	ar := NewAR(1, false)
+	ar.SetTracer(tracer)
+	// 第二个任务需等待第一个任务释放信号量
+	ar.AddAndRun("t1", func() { time.Sleep(20 * time.Millisecond) }, nil)
+	ar.Init("t2").CAdd(func() int {
+		return 1
+	}).CAdd(func(i int) {
+		panic(fmt.Sprint("step ", i))
+	}).CDO()
+	ar.Wait()
+	spans := tracer.Spans()
+	got := make([]string, len(spans))
+	for k, s := range spans {
+		got[k] = s.String()
+	}
+	if strings.Join(got, " ") != "1:t1<-0 2:t2<-0 3:t2/0<-2 4:t2/1<-2" {
+		t.Fatalf("spans: %v", got)
+	}
+	if len(spans[3].Errors) != 1 || spans[1].Attributes["jasync.status"] != STATUS_FAIL {
+		t.Fatalf("t2 spans: %+v %+v", spans[1], spans[3])
+	}
+	if wait := spans[1].Events[0].Attributes["jasync.wait"].(time.Duration); wait < 10*time.Millisecond {
+		t.Fatalf("t2 wait: %v", wait)
+	}
+	if spans[1].End.Before(spans[3].End) {
+		t.Fatal("chain span ended before step span")
+	}
+}
@@ -0,0 +1,98 @@
+package jasync
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录同时执行的任务的权重之和的最大值
+type weightCounter struct {
+	mu   sync.Mutex
+	cur  int64
+	max  int64
+	runs int
+}
+
+func (c *weightCounter) run(weight int64) {
+	c.mu.Lock()
+	c.cur += weight
+	c.runs++
+	if c.cur > c.max {
+		c.max = c.cur
+	}
+	c.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	c.cur -= weight
+	c.mu.Unlock()
+}
+
+func TestAsync_WithWeight(t *testing.T) {
+	a := New(false)
+	c := &weightCounter{}
+	for i := 0; i < 3; i++ {
+		a.Add("", func() { c.run(3) }, nil, WithWeight(3))
+		a.Add("", func() { c.run(1) }, nil)
+	}
+	a.Add("big", func() { c.run(5) }, nil, WithWeight(5))
+	a.Run(4)
+	a.Wait()
+	if c.max != 4 || c.runs != 6 {
+		t.Fatalf("max weight %d runs %d", c.max, c.runs)
+	}
+	if s := a.GetTaskStatus("big"); s != STATUS_FAIL || a.GetTaskErrors()["big"] == nil {
+		t.Fatalf("big status: %d", s)
+	}
+}
+
+func TestAsyncRealtime_WithWeight(t *testing.T) {
+	ar := NewAR(4, false)
+	c := &weightCounter{}
+	if _, ok, err := ar.AddAndRun("big", func() {}, nil, WithWeight(5)); ok || err == nil {
+		t.Fatal("weight beyond capacity should fail")
+	}
+	if err := ar.Init("big").CAdd(func() {}).COpt(WithWeight(5)).CDO(); err == nil {
+		t.Fatal("weight beyond capacity should fail")
+	}
+	for i := 0; i < 3; i++ {
+		ar.Init("").CAdd(func() { c.run(3) }).COpt(WithWeight(3)).CDO()
+		ar.AddAndRun("", func() { c.run(1) }, nil)
+	}
+	ar.Wait()
+	if c.max != 4 || c.runs != 6 {
+		t.Fatalf("max weight %d runs %d", c.max, c.runs)
+	}
+}
+
+func TestAsyncRealtime_WithWeightAdaptive(t *testing.T) {
+	ar := NewAR(2, false)
+	ar.SetAdaptiveLimit(AdaptiveLimit{Min: 1, Max: 8, Window: 1})
+	if _, _, err := ar.AddAndRun("big", func() {}, nil, WithWeight(9)); err == nil {
+		t.Fatal("weight beyond adaptive max should fail")
+	}
+	release := make(chan struct{})
+	ar.AddAndRun("t0", func() error {
+		<-release
+		return errors.New("fail")
+	}, nil)
+	// 权重超过当前并发数时，等待期间并发数增大到其权重
+	done := make(chan struct{})
+	go func() {
+		ar.AddAndRun("t1", func() {}, nil, WithWeight(5))
+		close(done)
+	}()
+	if isDone(done) {
+		t.Fatal("started while t0 is running")
+	}
+	if n := ar.sem.GetSize(); n != 5 {
+		t.Fatalf("limit while waiting: %d", n)
+	}
+	// t0失败后减小并发数，但不小于等待中的任务的权重
+	close(release)
+	if !isDone(done) {
+		t.Fatal("not started after t0 finished")
+	}
+	ar.Wait()
+}
@@ -25,6 +25,7 @@ type Weighted struct {
 	cur     int64
 	mu      sync.Mutex
 	waiters list.List
+	resized chan struct{} // Closed when size changes, for callers whose weight exceeds size.
 }
 
 // Acquire acquires the semaphore with a weight of n, blocking until resources
@@ -34,22 +35,33 @@ type Weighted struct {
 // If ctx is already done, Acquire may still succeed without blocking.
 func (s *Weighted) Acquire(ctx context.Context, n int64) error {
 	s.mu.Lock()
+	for n > s.size {
+		// Don't make other Acquire calls block on one that's doomed to fail;
+		// wait outside the queue until the semaphore is resized.
+		if s.resized == nil {
+			s.resized = make(chan struct{})
+		}
+		resized := s.resized
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resized:
+		}
+		s.mu.Lock()
+	}
 	if s.size-s.cur >= n && s.waiters.Len() == 0 {
 		s.cur += n
 		s.mu.Unlock()
 		return nil
 	}
 
-	if n > s.size {
-		// Don't make other Acquire calls block on one that's doomed to fail.
-		s.mu.Unlock()
-		<-ctx.Done()
-		return ctx.Err()
-	}
-
 	ready := make(chan struct{})
 	w := waiter{n: n, ready: ready}
 	elem := s.waiters.PushBack(w)
+	// Waiters ahead of us may have become doomed by shrinking, in which case
+	// nobody else would notify us.
+	s.notifyWaiters()
 	s.mu.Unlock()
 
 	select {
@@ -62,10 +74,10 @@ func (s *Weighted) Acquire(ctx context.Context, n int64) error {
 			// fix up the queue, just pretend we didn't notice the cancelation.
 			err = nil
 		default:
-			isFront := s.waiters.Front() == elem
 			s.waiters.Remove(elem)
-			// If we're at the front and there're extra tokens left, notify other waiters.
-			if isFront && s.size > s.cur {
+			// If there're extra tokens left, notify other waiters; we may have been
+			// blocking them even when not at the front, since doomed waiters are skipped.
+			if s.size > s.cur {
 				s.notifyWaiters()
 			}
 		}
@@ -89,6 +101,30 @@ func (s *Weighted) TryAcquire(n int64) bool {
 	return success
 }
 
+// Resize changes the maximum combined weight to n.
+//
+// Growing wakes the waiters that now fit. Shrinking does not affect current
+// holders: they drain as they Release, and new acquisitions block until the
+// combined weight drops below n. Waiters whose weight exceeds n are skipped
+// until the semaphore grows again.
+func (s *Weighted) Resize(n int64) {
+	s.mu.Lock()
+	s.size = n
+	if s.resized != nil {
+		close(s.resized)
+		s.resized = nil
+	}
+	s.notifyWaiters()
+	s.mu.Unlock()
+}
+
+// GetSize returns the maximum combined weight.
+func (s *Weighted) GetSize() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
 func (s *Weighted) GetCur() int64 {
 	var cur int64
 	s.mu.Lock()
@@ -110,13 +146,14 @@ func (s *Weighted) Release(n int64) {
 }
 
 func (s *Weighted) notifyWaiters() {
-	for {
-		next := s.waiters.Front()
-		if next == nil {
-			break // No more waiters blocked.
-		}
-
+	for next := s.waiters.Front(); next != nil; {
 		w := next.Value.(waiter)
+		if w.n > s.size {
+			// Doomed by shrinking; skip it rather than blocking everyone behind
+			// it until the semaphore grows again.
+			next = next.Next()
+			continue
+		}
 		if s.size-s.cur < w.n {
 			// Not enough tokens for the next waiter.  We could keep going (to try to
 			// find a waiter with a smaller request), but under load that could cause
@@ -133,7 +170,9 @@ func (s *Weighted) notifyWaiters() {
 		}
 
 		s.cur += w.n
-		s.waiters.Remove(next)
+		cur := next
+		next = next.Next()
+		s.waiters.Remove(cur)
 		close(w.ready)
 	}
 }
@@ -0,0 +1,84 @@
+package jasync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// 在后台获取信号量，获取成功后关闭返回的channel
+func acquireAsync(s *Weighted, n int64) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		if s.Acquire(context.Background(), n) == nil {
+			close(done)
+		}
+	}()
+	return done
+}
+
+func isDone(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(20 * time.Millisecond):
+		return false
+	}
+}
+
+func TestWeighted_Resize(t *testing.T) {
+	s := NewWeighted(1)
+	s.Acquire(context.Background(), 1)
+	// 增大时唤醒等待者
+	w1 := acquireAsync(s, 1)
+	if isDone(w1) {
+		t.Fatal("acquired beyond size")
+	}
+	s.Resize(2)
+	if !isDone(w1) {
+		t.Fatal("waiter not woken by growing")
+	}
+	// 超过size的等待者在增大后才能获取
+	big := acquireAsync(s, 3)
+	// 减小时已持有的不受影响，释放到n以下后才能再次获取
+	s.Resize(1)
+	w2 := acquireAsync(s, 1)
+	s.Release(1)
+	if isDone(w2) {
+		t.Fatal("acquired before draining")
+	}
+	s.Release(1)
+	if !isDone(w2) {
+		t.Fatal("waiter not woken after draining")
+	}
+	s.Release(1)
+	if isDone(big) {
+		t.Fatal("acquired beyond size")
+	}
+	s.Resize(3)
+	if !isDone(big) {
+		t.Fatal("doomed waiter not woken by growing")
+	}
+	if s.GetCur() != 3 || s.GetSize() != 3 {
+		t.Fatalf("cur %d size %d", s.GetCur(), s.GetSize())
+	}
+}
+
+func TestAsyncRealtime_SetConcurrency(t *testing.T) {
+	ar := NewAR(1, false)
+	if ar.SetConcurrency(0) == nil {
+		t.Fatal("SetConcurrency(0) should fail")
+	}
+	c := newRunningCounter()
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		ar.SetConcurrency(3)
+	}()
+	for i := 0; i < 6; i++ {
+		ar.AddAndRun("", func() { c.run("", 50*time.Millisecond) }, nil)
+	}
+	ar.Wait()
+	if c.max[""] != 3 {
+		t.Fatalf("max running: %d", c.max[""])
+	}
+}